@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+// CloudInfo attributes an address to a cloud or CDN provider
+type CloudInfo struct {
+	Provider string `json:"provider"`
+	Region   string `json:"region,omitempty"`
+	Service  string `json:"service,omitempty"`
+}
+
+// String formats the attribution as provider/region/service, skipping empty parts
+func (c *CloudInfo) String() string {
+	parts := []string{c.Provider}
+	if c.Region != "" {
+		parts = append(parts, c.Region)
+	}
+	if c.Service != "" {
+		parts = append(parts, c.Service)
+	}
+	return strings.Join(parts, "/")
+}
+
+// trieNode is a node of a binary prefix trie
+type trieNode struct {
+	child [2]*trieNode
+	info  *CloudInfo
+}
+
+// CloudRanges maps IP prefixes to providers with longest-prefix matching
+type CloudRanges struct {
+	v4, v6   trieNode
+	prefixes int
+}
+
+// NewCloudRanges creates an empty prefix trie
+func NewCloudRanges() *CloudRanges {
+	return &CloudRanges{}
+}
+
+// Insert adds a prefix; when the same prefix is inserted twice, the first
+// entry with a service wins so that broad catch-all tags do not mask it
+func (c *CloudRanges) Insert(prefix netip.Prefix, info CloudInfo) {
+	prefix = prefix.Masked()
+	addr := prefix.Addr().Unmap()
+	bits := prefix.Bits()
+	if prefix.Addr().Is4In6() {
+		bits -= 96
+	}
+
+	node := &c.v6
+	if addr.Is4() {
+		node = &c.v4
+	}
+	b := addr.AsSlice()
+	for i := 0; i < bits; i++ {
+		bit := b[i/8] >> (7 - i%8) & 1
+		if node.child[bit] == nil {
+			node.child[bit] = &trieNode{}
+		}
+		node = node.child[bit]
+	}
+
+	if node.info == nil {
+		c.prefixes++
+	}
+	if node.info == nil || (node.info.Service == "" && info.Service != "") {
+		node.info = &info
+	}
+}
+
+// Lookup returns the most specific attribution for addr, or nil
+func (c *CloudRanges) Lookup(addr netip.Addr) *CloudInfo {
+	addr = addr.Unmap()
+	node := &c.v6
+	if addr.Is4() {
+		node = &c.v4
+	}
+
+	found := node.info
+	b := addr.AsSlice()
+	for i := 0; i < len(b)*8; i++ {
+		node = node.child[b[i/8]>>(7-i%8)&1]
+		if node == nil {
+			break
+		}
+		if node.info != nil {
+			found = node.info
+		}
+	}
+	return found
+}
+
+// Len returns the number of distinct prefixes loaded
+func (c *CloudRanges) Len() int {
+	return c.prefixes
+}
+
+// rangeParsers reads each vendor's published format, keyed by file name
+// Any other *.txt file is a plain CIDR list named after the file
+var rangeParsers = map[string]func(c *CloudRanges, data []byte) error{
+	"aws.json":        parseAWSRanges,
+	"gcp.json":        parseGCPRanges,
+	"azure.json":      parseAzureRanges,
+	"cloudflare.json": parseCloudflareRanges,
+}
+
+// DefaultRangesDir returns where provider range files are kept
+func DefaultRangesDir() string {
+	return filepath.Join(ipthc.DefaultCacheDir(), "ranges")
+}
+
+// LoadCloudRanges loads every provider range file found in dir
+func LoadCloudRanges(dir string) (*CloudRanges, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ranges directory: %w", err)
+	}
+
+	c := NewCloudRanges()
+	files := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		parse, ok := rangeParsers[name]
+		if !ok && filepath.Ext(name) == ".txt" {
+			provider := strings.TrimSuffix(name, ".txt")
+			parse = func(c *CloudRanges, data []byte) error {
+				return parseCIDRList(c, provider, data)
+			}
+			ok = true
+		}
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if err := parse(c, data); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		files++
+	}
+
+	if files == 0 {
+		return nil, fmt.Errorf("no provider range files in %s (run: ipthc ranges update)", dir)
+	}
+	return c, nil
+}
+
+// insertPrefix parses and inserts one prefix string
+func (c *CloudRanges) insertPrefix(s string, info CloudInfo) error {
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("invalid prefix %q", s)
+	}
+	c.Insert(prefix, info)
+	return nil
+}
+
+// parseAWSRanges reads https://ip-ranges.amazonaws.com/ip-ranges.json
+func parseAWSRanges(c *CloudRanges, data []byte) error {
+	var doc struct {
+		Prefixes []struct {
+			IPPrefix string `json:"ip_prefix"`
+			Region   string `json:"region"`
+			Service  string `json:"service"`
+		} `json:"prefixes"`
+		IPv6Prefixes []struct {
+			IPv6Prefix string `json:"ipv6_prefix"`
+			Region     string `json:"region"`
+			Service    string `json:"service"`
+		} `json:"ipv6_prefixes"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	// The catch-all AMAZON service repeats prefixes that also have a specific service
+	service := func(s string) string {
+		if s == "AMAZON" {
+			return ""
+		}
+		return s
+	}
+	for _, p := range doc.Prefixes {
+		if err := c.insertPrefix(p.IPPrefix, CloudInfo{Provider: "aws", Region: p.Region, Service: service(p.Service)}); err != nil {
+			return err
+		}
+	}
+	for _, p := range doc.IPv6Prefixes {
+		if err := c.insertPrefix(p.IPv6Prefix, CloudInfo{Provider: "aws", Region: p.Region, Service: service(p.Service)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseGCPRanges reads https://www.gstatic.com/ipranges/cloud.json
+func parseGCPRanges(c *CloudRanges, data []byte) error {
+	var doc struct {
+		Prefixes []struct {
+			IPv4Prefix string `json:"ipv4Prefix"`
+			IPv6Prefix string `json:"ipv6Prefix"`
+			Service    string `json:"service"`
+			Scope      string `json:"scope"`
+		} `json:"prefixes"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	for _, p := range doc.Prefixes {
+		prefix := p.IPv4Prefix
+		if prefix == "" {
+			prefix = p.IPv6Prefix
+		}
+		if err := c.insertPrefix(prefix, CloudInfo{Provider: "gcp", Region: p.Scope, Service: p.Service}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseAzureRanges reads the weekly Azure Service Tags file (ServiceTags_Public_*.json)
+func parseAzureRanges(c *CloudRanges, data []byte) error {
+	var doc struct {
+		Values []struct {
+			Name       string `json:"name"`
+			Properties struct {
+				Region          string   `json:"region"`
+				SystemService   string   `json:"systemService"`
+				AddressPrefixes []string `json:"addressPrefixes"`
+			} `json:"properties"`
+		} `json:"values"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	for _, v := range doc.Values {
+		info := CloudInfo{Provider: "azure", Region: v.Properties.Region, Service: v.Properties.SystemService}
+		for _, prefix := range v.Properties.AddressPrefixes {
+			if err := c.insertPrefix(prefix, info); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseCloudflareRanges reads https://api.cloudflare.com/client/v4/ips
+func parseCloudflareRanges(c *CloudRanges, data []byte) error {
+	var doc struct {
+		Result struct {
+			IPv4 []string `json:"ipv4_cidrs"`
+			IPv6 []string `json:"ipv6_cidrs"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	for _, prefix := range append(doc.Result.IPv4, doc.Result.IPv6...) {
+		if err := c.insertPrefix(prefix, CloudInfo{Provider: "cloudflare", Service: "CDN"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseCIDRList reads one CIDR per line, as published by e.g. Akamai
+func parseCIDRList(c *CloudRanges, provider string, data []byte) error {
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := ipthc.SanitizeInput(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if err := c.insertPrefix(line, CloudInfo{Provider: provider}); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// CloudWriter tags IP inputs and IP results with their cloud provider
+type CloudWriter struct {
+	out    ResultWriter
+	ranges *CloudRanges
+	tagged atomic.Int64
+}
+
+// NewCloudWriter creates a result writer that annotates addresses found in ranges
+func NewCloudWriter(out ResultWriter, ranges *CloudRanges) *CloudWriter {
+	return &CloudWriter{out: out, ranges: ranges}
+}
+
+func (c *CloudWriter) Write(r Result) error {
+	if r.IsMarker() {
+		return c.out.Write(r)
+	}
+	if addr, err := netip.ParseAddr(r.Input); err == nil {
+		r.InputCloud = c.ranges.Lookup(addr)
+	}
+	if addr, err := netip.ParseAddr(r.Result); err == nil {
+		r.ResultCloud = c.ranges.Lookup(addr)
+	}
+	if r.InputCloud != nil || r.ResultCloud != nil {
+		c.tagged.Add(1)
+	}
+	return c.out.Write(r)
+}
+
+func (c *CloudWriter) Close() error {
+	return c.out.Close()
+}
+
+// Tagged returns the number of results that were attributed to a provider
+func (c *CloudWriter) Tagged() int64 {
+	return c.tagged.Load()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+// Trimmed samples of each vendor's published format
+const (
+	awsFixture = `{"syncToken":"1","prefixes":[
+		{"ip_prefix":"3.0.0.0/8","region":"GLOBAL","service":"AMAZON"},
+		{"ip_prefix":"3.5.0.0/16","region":"us-east-1","service":"AMAZON"},
+		{"ip_prefix":"3.5.0.0/16","region":"us-east-1","service":"S3"},
+		{"ip_prefix":"3.5.140.0/22","region":"ap-northeast-2","service":"EC2"}],
+		"ipv6_prefixes":[{"ipv6_prefix":"2600:1f00::/24","region":"us-west-2","service":"EC2"}]}`
+	gcpFixture = `{"prefixes":[
+		{"ipv4Prefix":"34.80.0.0/15","service":"Google Cloud","scope":"asia-east1"},
+		{"ipv6Prefix":"2600:1900:4000::/44","service":"Google Cloud","scope":"us-central1"}]}`
+	azureFixture = `{"values":[
+		{"name":"AzureCloud","properties":{"region":"","systemService":"","addressPrefixes":["20.0.0.0/8"]}},
+		{"name":"AzureFrontDoor.Frontend","properties":{"region":"","systemService":"AzureFrontDoor","addressPrefixes":["20.21.37.0/24"]}}]}`
+	cloudflareFixture = `{"result":{"ipv4_cidrs":["104.16.0.0/13"],"ipv6_cidrs":["2606:4700::/32"]},"success":true}`
+	akamaiFixture     = "# Akamai origin ACL\n23.32.0.0/11\n"
+)
+
+func writeRangesDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"aws.json":        awsFixture,
+		"gcp.json":        gcpFixture,
+		"azure.json":      azureFixture,
+		"cloudflare.json": cloudflareFixture,
+		"akamai.txt":      akamaiFixture,
+		"README":          "ignored",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadCloudRanges(t *testing.T) {
+	ranges, err := LoadCloudRanges(writeRangesDir(t))
+	if err != nil {
+		t.Fatalf("LoadCloudRanges failed: %v", err)
+	}
+
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		{"3.1.2.3", "aws/GLOBAL"},
+		{"3.5.1.1", "aws/us-east-1/S3"},
+		{"3.5.141.7", "aws/ap-northeast-2/EC2"},
+		{"2600:1f00::1", "aws/us-west-2/EC2"},
+		{"34.81.0.1", "gcp/asia-east1/Google Cloud"},
+		{"2600:1900:4000::5", "gcp/us-central1/Google Cloud"},
+		{"20.1.1.1", "azure"},
+		{"20.21.37.40", "azure/AzureFrontDoor"},
+		{"104.18.1.1", "cloudflare/CDN"},
+		{"::ffff:104.18.1.1", "cloudflare/CDN"},
+		{"23.40.0.1", "akamai"},
+		{"8.8.8.8", ""},
+		{"2001:db8::1", ""},
+	}
+
+	for _, tt := range tests {
+		got := ""
+		if info := ranges.Lookup(netip.MustParseAddr(tt.addr)); info != nil {
+			got = info.String()
+		}
+		if got != tt.expected {
+			t.Errorf("Lookup(%s) = %q, want %q", tt.addr, got, tt.expected)
+		}
+	}
+}
+
+func TestLoadCloudRanges_Errors(t *testing.T) {
+	if _, err := LoadCloudRanges(t.TempDir()); err == nil || !strings.Contains(err.Error(), "ranges update") {
+		t.Errorf("empty directory should point at ranges update, got %v", err)
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "aws.json"), []byte(`{"prefixes":[{"ip_prefix":"nonsense"}]}`), 0644)
+	if _, err := LoadCloudRanges(dir); err == nil {
+		t.Error("invalid prefix should fail")
+	}
+}
+
+func TestCloudWriter(t *testing.T) {
+	ranges, _ := LoadCloudRanges(writeRangesDir(t))
+
+	var buf bytes.Buffer
+	out, _ := NewResultWriter(FormatText, &buf, false)
+	w := NewCloudWriter(out, ranges)
+
+	w.Write(Result{Mode: ipthc.ModeDNS, Input: "3.5.1.1", Result: "s3.example.com"})
+	w.Write(Result{Mode: ipthc.ModeDNS, Input: "8.8.8.8", Result: "dns.google"})
+	w.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "104.16.0.1"})
+	w.Write(Result{Mode: ipthc.ModeDNS, Input: "3.5.1.2", Truncated: &Truncation{Pages: 1, Fetched: 100, Total: 900}}) // not a result
+	w.Close()
+
+	want := "s3.example.com\tcloud=aws/us-east-1/S3\ndns.google\n104.16.0.1\tresult_cloud=cloudflare/CDN\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+	if w.Tagged() != 2 {
+		t.Errorf("Tagged() = %d, want 2", w.Tagged())
+	}
+}
+
+func TestRunRangesCommand_Update(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/aws":
+			w.Write([]byte(awsFixture))
+		case "/azure-page":
+			w.Write([]byte(`<a href="` + "http://" + r.Host + `/download/ServiceTags_Public_20260101.json">Download</a>`))
+		case "/download/ServiceTags_Public_20260101.json":
+			w.Write([]byte(azureFixture))
+		case "/garbage":
+			w.Write([]byte("<html>maintenance</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	saved := rangeSources
+	defer func() { rangeSources = saved }()
+	rangeSources = []rangeSource{
+		{File: "aws.json", URL: server.URL + "/aws"},
+		{File: "azure.json", URL: server.URL + "/azure-page", Link: regexp.MustCompile(`http://[^"]+/ServiceTags_Public_\d+\.json`)},
+	}
+
+	dir := filepath.Join(t.TempDir(), "ranges")
+	var stdout, stderr bytes.Buffer
+	if code := runRangesCommand([]string{"update", "-dir", dir}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+
+	ranges, err := LoadCloudRanges(dir)
+	if err != nil {
+		t.Fatalf("updated files do not load: %v", err)
+	}
+	if info := ranges.Lookup(netip.MustParseAddr("20.21.37.1")); info == nil || info.Provider != "azure" {
+		t.Errorf("azure ranges missing after update: %v", info)
+	}
+
+	// A bad download is reported and leaves the previous file in place
+	rangeSources = []rangeSource{{File: "gcp.json", URL: server.URL + "/garbage"}, {File: "aws.json", URL: server.URL + "/missing"}}
+	stderr.Reset()
+	if code := runRangesCommand([]string{"update", "-dir", dir}, &stdout, &stderr); code == 0 {
+		t.Error("failed downloads should give a non-zero exit code")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gcp.json")); !os.IsNotExist(err) {
+		t.Error("invalid data should not be written")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "aws.json")); string(data) != awsFixture {
+		t.Error("previous aws.json should be kept")
+	}
+}
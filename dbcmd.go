@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+// runDBCommand implements the `ipthc db` subcommands and returns the exit code
+func runDBCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "query" {
+		fmt.Fprintln(stderr, "Usage: ipthc db query -db <path.sqlite> [-mode <mode>] [-since <duration>] [-o text|ndjson] <target>...")
+		return 1
+	}
+
+	fs := flag.NewFlagSet("db query", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dbPath := fs.String("db", "", "SQLite result store to query")
+	mode := fs.String("mode", "", "Only show results for this mode (dns, subs or cname)")
+	since := fs.Duration("since", 0, "Only show results first seen within this long, e.g. 168h for the last week")
+	format := fs.String("o", FormatText, "Output format: text or ndjson")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return 1
+	}
+
+	if *dbPath == "" || fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "Error: -db and at least one target are required")
+		fs.Usage()
+		return 1
+	}
+	if *format != FormatText && *format != FormatNDJSON {
+		fmt.Fprintf(stderr, "Error: unknown output format: %s\n", *format)
+		return 1
+	}
+	if *mode != "" && !slices.Contains(AllModes, *mode) {
+		fmt.Fprintf(stderr, "Error: unknown mode: %s\n", *mode)
+		return 1
+	}
+	if _, err := os.Stat(*dbPath); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	store, err := OpenResultStore(*dbPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+
+	q := StoreQuery{Mode: *mode}
+	if *since > 0 {
+		q.Since = time.Now().Add(-*since)
+	}
+
+	enc := json.NewEncoder(stdout)
+	for _, target := range fs.Args() {
+		q.Input = ipthc.SanitizeInput(target)
+		results, err := store.Query(q)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 1
+		}
+
+		for _, r := range results {
+			if *format == FormatNDJSON {
+				enc.Encode(r)
+				continue
+			}
+			fmt.Fprintf(stdout, "%s\t%s\t%s\t%s\t%s\n",
+				r.FirstSeen.Format("2006-01-02 15:04:05"),
+				r.LastSeen.Format("2006-01-02 15:04:05"),
+				r.Mode, r.Input, r.Result)
+		}
+	}
+
+	return 0
+}
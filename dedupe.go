@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"hash/maphash"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultDedupeFP = 0.001
+
+// SeenSet remembers which keys have been added
+// Implementations are safe for concurrent use
+type SeenSet interface {
+	// Add adds key and reports whether it was new
+	Add(key string) bool
+}
+
+// exactSet is a SeenSet that never gives false positives but holds every key
+type exactSet struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+// NewExactSet creates an exact in-memory set
+func NewExactSet() SeenSet {
+	return &exactSet{keys: make(map[string]struct{})}
+}
+
+func (s *exactSet) Add(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[key]; ok {
+		return false
+	}
+	s.keys[key] = struct{}{}
+	return true
+}
+
+// BloomFilter is a SeenSet with fixed memory. Add may wrongly report a new key
+// as seen (a false positive) at roughly the rate it was sized for, but never
+// reports a repeated key as new.
+type BloomFilter struct {
+	mu    sync.Mutex
+	bits  []uint64
+	m     uint64 // Number of bits
+	k     int    // Number of hash functions
+	seed  maphash.Seed
+	seed2 maphash.Seed
+}
+
+// NewBloomFilter sizes a Bloom filter for capacity keys at false positive rate fp
+func NewBloomFilter(capacity int, fp float64) (*BloomFilter, error) {
+	if capacity < 1 {
+		return nil, fmt.Errorf("bloom filter capacity must be at least 1")
+	}
+	if fp <= 0 || fp >= 1 {
+		return nil, fmt.Errorf("bloom filter false positive rate must be between 0 and 1")
+	}
+
+	n := float64(capacity)
+	m := math.Ceil(-n * math.Log(fp) / (math.Ln2 * math.Ln2))
+	k := int(math.Round(m / n * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	words := (uint64(m) + 63) / 64
+	return &BloomFilter{
+		bits:  make([]uint64, words),
+		m:     words * 64,
+		k:     k,
+		seed:  maphash.MakeSeed(),
+		seed2: maphash.MakeSeed(),
+	}, nil
+}
+
+// Size returns the memory used by the filter's bit array in bytes
+func (b *BloomFilter) Size() int {
+	return len(b.bits) * 8
+}
+
+// Add sets the key's bits and reports whether any of them was unset
+// The k bit positions come from two hashes (Kirsch-Mitzenmacher)
+func (b *BloomFilter) Add(key string) bool {
+	h1 := maphash.String(b.seed, key)
+	h2 := maphash.String(b.seed2, key) | 1
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	added := false
+	for i := 0; i < b.k; i++ {
+		bit := (h1 + uint64(i)*h2) % b.m
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if b.bits[word]&mask == 0 {
+			b.bits[word] |= mask
+			added = true
+		}
+	}
+	return added
+}
+
+// DedupeWriter drops results whose mode and value were already written
+type DedupeWriter struct {
+	out        ResultWriter
+	seen       SeenSet
+	suppressed atomic.Int64
+}
+
+// NewDedupeWriter creates a result writer that passes on each distinct
+// mode and result once, across all inputs and pages
+func NewDedupeWriter(out ResultWriter, seen SeenSet) *DedupeWriter {
+	return &DedupeWriter{out: out, seen: seen}
+}
+
+func (d *DedupeWriter) Write(r Result) error {
+	if r.IsMarker() {
+		return d.out.Write(r)
+	}
+
+	// Added and removed diff lines for the same result are both kept
+	if !d.seen.Add(r.Change + "\x00" + r.Mode + "\x00" + r.Result) {
+		d.suppressed.Add(1)
+		return nil
+	}
+	return d.out.Write(r)
+}
+
+func (d *DedupeWriter) Close() error {
+	return d.out.Close()
+}
+
+// Suppressed returns the number of duplicate results dropped
+func (d *DedupeWriter) Suppressed() int64 {
+	return d.suppressed.Load()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+func TestExactSet(t *testing.T) {
+	s := NewExactSet()
+
+	if !s.Add("a") {
+		t.Error("first Add should report a new key")
+	}
+	if s.Add("a") {
+		t.Error("second Add should report a seen key")
+	}
+	if !s.Add("b") {
+		t.Error("a different key should be new")
+	}
+}
+
+func TestBloomFilter_NoFalseNegatives(t *testing.T) {
+	b, err := NewBloomFilter(10000, 0.01)
+	if err != nil {
+		t.Fatalf("NewBloomFilter failed: %v", err)
+	}
+
+	for i := 0; i < 10000; i++ {
+		b.Add(fmt.Sprintf("host-%d.example.com", i))
+	}
+	for i := 0; i < 10000; i++ {
+		if b.Add(fmt.Sprintf("host-%d.example.com", i)) {
+			t.Fatalf("key %d reported as new after being added", i)
+		}
+	}
+}
+
+func TestBloomFilter_FalsePositiveRate(t *testing.T) {
+	const n = 20000
+	// Probing adds keys too, so size for everything that will be added
+	b, _ := NewBloomFilter(2*n, 0.01)
+
+	for i := 0; i < n; i++ {
+		b.Add(fmt.Sprintf("seen-%d", i))
+	}
+
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if !b.Add(fmt.Sprintf("unseen-%d", i)) {
+			falsePositives++
+		}
+	}
+
+	if rate := float64(falsePositives) / n; rate > 0.02 {
+		t.Errorf("false positive rate %.4f, want about 0.01", rate)
+	}
+}
+
+func TestNewBloomFilter_Invalid(t *testing.T) {
+	if _, err := NewBloomFilter(0, 0.01); err == nil {
+		t.Error("zero capacity should fail")
+	}
+	if _, err := NewBloomFilter(100, 0); err == nil {
+		t.Error("zero false positive rate should fail")
+	}
+	if _, err := NewBloomFilter(100, 1); err == nil {
+		t.Error("false positive rate of 1 should fail")
+	}
+}
+
+func TestDedupeWriter(t *testing.T) {
+	var buf bytes.Buffer
+	out, _ := NewResultWriter(FormatText, &buf, true)
+	w := NewDedupeWriter(out, NewExactSet())
+
+	w.Write(Result{Mode: ipthc.ModeDNS, Input: "1.1.1.1", Result: "shared.example.com", Page: 1})
+	w.Write(Result{Mode: ipthc.ModeDNS, Input: "1.1.1.2", Result: "shared.example.com", Page: 1})
+	w.Write(Result{Mode: ipthc.ModeDNS, Input: "1.1.1.1", Result: "shared.example.com", Page: 2})
+	w.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "shared.example.com"})
+	w.Write(Result{Mode: ipthc.ModeDNS, Input: "1.1.1.3", Result: "other.example.com"})
+	w.Close()
+
+	want := "dns\tshared.example.com\nsubs\tshared.example.com\ndns\tother.example.com\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+	if w.Suppressed() != 2 {
+		t.Errorf("Suppressed() = %d, want 2", w.Suppressed())
+	}
+}
+
+func TestDedupeWriter_Concurrent(t *testing.T) {
+	var buf bytes.Buffer
+	out, _ := NewResultWriter(FormatText, &buf, false)
+	bloom, _ := NewBloomFilter(1000, 0.001)
+	w := NewDedupeWriter(out, bloom)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				w.Write(Result{Mode: ipthc.ModeDNS, Result: fmt.Sprintf("host-%d", i)})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every duplicate is caught; a false positive could only lower the count
+	if lines := bytes.Count(buf.Bytes(), []byte("\n")); lines > 100 || lines < 99 {
+		t.Errorf("expected about 100 distinct lines, got %d", lines)
+	}
+}
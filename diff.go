@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Change markers for diff output
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+)
+
+// sqliteHeader starts every SQLite database file
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// Baseline is the set of results a previous run found, per mode and input
+type Baseline struct {
+	results map[string]map[string]bool // "mode input" -> results
+}
+
+func newBaseline() *Baseline {
+	return &Baseline{results: make(map[string]map[string]bool)}
+}
+
+func (b *Baseline) add(mode, input, result string) {
+	key := stateKey(mode, input)
+	if b.results[key] == nil {
+		b.results[key] = make(map[string]bool)
+	}
+	b.results[key][result] = true
+}
+
+// Has reports whether the baseline contains a result
+func (b *Baseline) Has(mode, input, result string) bool {
+	return b.results[stateKey(mode, input)][result]
+}
+
+// Len returns the number of results in the baseline
+func (b *Baseline) Len() int {
+	n := 0
+	for _, set := range b.results {
+		n += len(set)
+	}
+	return n
+}
+
+// Restrict drops baseline results outside scope, so results a scoped run
+// filters out are neither reported as added nor as removed
+func (b *Baseline) Restrict(scope *Scope) {
+	for _, set := range b.results {
+		for result := range set {
+			if !scope.InScope(result) {
+				delete(set, result)
+			}
+		}
+	}
+}
+
+// LoadBaseline reads a previous run from path, which is either NDJSON or JSON
+// output (-o ndjson / -o json) or a -db database, whose latest run is used
+func LoadBaseline(path string) (*Baseline, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open diff baseline: %w", err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	if header, _ := r.Peek(len(sqliteHeader)); bytes.Equal(header, sqliteHeader) {
+		file.Close()
+		return loadStoreBaseline(path)
+	}
+	return readBaseline(r)
+}
+
+// readBaseline parses NDJSON or a JSON array of Results
+// Removed entries from an earlier diff are not part of that run's results
+func readBaseline(r *bufio.Reader) (*Baseline, error) {
+	var results []Result
+	dec := json.NewDecoder(r)
+
+	first, err := firstByte(r)
+	switch {
+	case err == io.EOF:
+		// An empty file is a run without results
+		err = nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read diff baseline: %w", err)
+	case first == '[':
+		err = dec.Decode(&results)
+	default:
+		for {
+			var res Result
+			if err = dec.Decode(&res); err != nil {
+				break
+			}
+			results = append(results, res)
+		}
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("diff baseline is not JSON or NDJSON output (use -o ndjson or -db): %w", err)
+	}
+
+	b := newBaseline()
+	for _, res := range results {
+		if res.Change != ChangeRemoved && !res.IsMarker() {
+			b.add(res.Mode, res.Input, res.Result)
+		}
+	}
+	return b, nil
+}
+
+// firstByte returns the first non-whitespace byte without consuming it
+func firstByte(r *bufio.Reader) (byte, error) {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			return c, r.UnreadByte()
+		}
+	}
+}
+
+// loadStoreBaseline loads the results seen in the latest finished run of a -db database
+func loadStoreBaseline(path string) (*Baseline, error) {
+	store, err := OpenResultStore(path)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	results, err := store.LastRun()
+	if err != nil {
+		return nil, err
+	}
+
+	b := newBaseline()
+	for _, r := range results {
+		b.add(r.Mode, r.Input, r.Result)
+	}
+	return b, nil
+}
+
+// DiffWriter passes on only results that are not in a baseline, marked as added,
+// and on Close reports baseline results that were not seen again as removed.
+// Removals are only reported for queries marked Complete, so inputs that
+// failed or were not part of this run never look like they lost everything.
+type DiffWriter struct {
+	mu       sync.Mutex
+	out      ResultWriter
+	baseline *Baseline
+	current  map[string]map[string]bool // "mode input" -> results seen this run
+	complete map[string]Result          // "mode input" -> query that finished
+	added    int
+	removed  int
+}
+
+// NewDiffWriter creates a diff writer comparing results against baseline
+func NewDiffWriter(out ResultWriter, baseline *Baseline) *DiffWriter {
+	return &DiffWriter{
+		out:      out,
+		baseline: baseline,
+		current:  make(map[string]map[string]bool),
+		complete: make(map[string]Result),
+	}
+}
+
+// Write forwards a result if it is new
+func (d *DiffWriter) Write(r Result) error {
+	if r.IsMarker() {
+		return d.out.Write(r)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := stateKey(r.Mode, r.Input)
+	if d.current[key] == nil {
+		d.current[key] = make(map[string]bool)
+	}
+	if d.current[key][r.Result] {
+		return nil
+	}
+	d.current[key][r.Result] = true
+
+	if d.baseline.Has(r.Mode, r.Input, r.Result) {
+		return nil
+	}
+
+	d.added++
+	r.Change = ChangeAdded
+	return d.out.Write(r)
+}
+
+// Complete records that a query finished, so missing results count as removed
+func (d *DiffWriter) Complete(job Job) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.complete[stateKey(job.Mode, job.Input)] = Result{
+		Mode:  job.Mode,
+		Input: job.Input,
+		Range: job.Range,
+		Depth: job.Depth,
+		From:  job.From,
+	}
+}
+
+// Changes returns the number of added and removed results reported so far
+func (d *DiffWriter) Changes() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.added + d.removed
+}
+
+// Close writes removed results, sorted by mode, input and result, then closes
+// the underlying writer
+func (d *DiffWriter) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	keys := make([]string, 0, len(d.complete))
+	for key := range d.complete {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	ts := time.Now().Unix()
+	var errs []error
+	for _, key := range keys {
+		var gone []string
+		for result := range d.baseline.results[key] {
+			if !d.current[key][result] {
+				gone = append(gone, result)
+			}
+		}
+		sort.Strings(gone)
+
+		for _, result := range gone {
+			r := d.complete[key]
+			r.Result = result
+			r.Timestamp = ts
+			r.Change = ChangeRemoved
+			d.removed++
+			if err := d.out.Write(r); err != nil {
+				errs = append(errs, err)
+				break
+			}
+		}
+	}
+
+	errs = append(errs, d.out.Close())
+	return errors.Join(errs...)
+}
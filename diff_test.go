@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+func TestReadBaseline_NDJSONAndJSON(t *testing.T) {
+	ndjson := `{"input":"example.com","mode":"subs","result":"a.example.com","page":1,"total":2,"ts":1}
+{"input":"example.com","mode":"subs","result":"b.example.com","page":1,"total":2,"ts":1}
+{"input":"example.com","mode":"subs","result":"gone.example.com","ts":1,"change":"removed"}
+{"input":"big.example.com","mode":"subs","result":"","total":900,"ts":1,"truncated":{"pages":1,"fetched":100,"total":900}}
+`
+	array := `[{"input":"example.com","mode":"subs","result":"a.example.com"}
+,{"input":"example.com","mode":"subs","result":"b.example.com"}
+]`
+
+	for name, data := range map[string]string{"ndjson": ndjson, "json": array} {
+		path := filepath.Join(t.TempDir(), "prev."+name)
+		os.WriteFile(path, []byte(data), 0644)
+
+		b, err := LoadBaseline(path)
+		if err != nil {
+			t.Fatalf("%s: LoadBaseline failed: %v", name, err)
+		}
+		if b.Len() != 2 {
+			t.Errorf("%s: got %d results, want 2", name, b.Len())
+		}
+		if !b.Has(ipthc.ModeSubs, "example.com", "a.example.com") || b.Has(ipthc.ModeSubs, "example.com", "gone.example.com") {
+			t.Errorf("%s: unexpected baseline contents", name)
+		}
+	}
+}
+
+func TestReadBaseline_EmptyIsARunWithoutResults(t *testing.T) {
+	for name, data := range map[string]string{"empty": "", "whitespace": " \n\t\n"} {
+		path := filepath.Join(t.TempDir(), "prev.ndjson")
+		os.WriteFile(path, []byte(data), 0644)
+
+		b, err := LoadBaseline(path)
+		if err != nil {
+			t.Fatalf("%s: LoadBaseline failed: %v", name, err)
+		}
+		if b.Len() != 0 {
+			t.Errorf("%s: got %d results, want 0", name, b.Len())
+		}
+	}
+}
+
+func TestReadBaseline_RejectsText(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prev.txt")
+	os.WriteFile(path, []byte("a.example.com\nb.example.com\n"), 0644)
+
+	if _, err := LoadBaseline(path); err == nil {
+		t.Error("text output should be rejected as a baseline")
+	}
+}
+
+func TestLoadBaseline_FromStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.sqlite")
+
+	store, _ := OpenResultStore(path)
+	store.StartRun()
+	store.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "old.example.com"})
+	store.Finish()
+	store.Close()
+
+	store, _ = OpenResultStore(path)
+	store.StartRun()
+	store.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "www.example.com"})
+	store.Finish()
+	store.Close()
+
+	b, err := LoadBaseline(path)
+	if err != nil {
+		t.Fatalf("LoadBaseline failed: %v", err)
+	}
+	if b.Len() != 1 || !b.Has(ipthc.ModeSubs, "example.com", "www.example.com") {
+		t.Errorf("baseline should hold only the latest run, got %d results", b.Len())
+	}
+}
+
+func TestDiffWriter_AddedAndRemoved(t *testing.T) {
+	baseline := newBaseline()
+	baseline.add(ipthc.ModeSubs, "example.com", "kept.example.com")
+	baseline.add(ipthc.ModeSubs, "example.com", "gone.example.com")
+	baseline.add(ipthc.ModeSubs, "failed.com", "www.failed.com")
+
+	var buf bytes.Buffer
+	out, _ := NewResultWriter(FormatText, &buf, false)
+	diff := NewDiffWriter(out, baseline)
+
+	diff.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "kept.example.com"})
+	diff.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "new.example.com"})
+	diff.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "new.example.com"})
+	diff.Complete(Job{Mode: ipthc.ModeSubs, Input: "example.com"})
+	// failed.com never completed, so its baseline results are not reported as removed
+	if err := diff.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	want := "+\tsubs\texample.com\tnew.example.com\n-\tsubs\texample.com\tgone.example.com\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+	if diff.Changes() != 2 {
+		t.Errorf("Changes() = %d, want 2", diff.Changes())
+	}
+}
+
+func TestDiffWriter_NoChanges(t *testing.T) {
+	baseline := newBaseline()
+	baseline.add(ipthc.ModeDNS, "1.1.1.1", "one.one.one.one")
+
+	var buf bytes.Buffer
+	out, _ := NewResultWriter(FormatNDJSON, &buf, false)
+	diff := NewDiffWriter(out, baseline)
+
+	diff.Write(Result{Mode: ipthc.ModeDNS, Input: "1.1.1.1", Result: "one.one.one.one"})
+	diff.Complete(Job{Mode: ipthc.ModeDNS, Input: "1.1.1.1"})
+	diff.Close()
+
+	if buf.Len() != 0 || diff.Changes() != 0 {
+		t.Errorf("expected no output, got %q", buf.String())
+	}
+}
+
+func TestRunner_DiffAgainstPreviousRun(t *testing.T) {
+	results := "a.example.com\nb.example.com"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(";;Entries: 2/2\n" + results))
+	}))
+	defer server.Close()
+
+	// First run records the baseline as NDJSON
+	var prev bytes.Buffer
+	runner := newTestRunner(t, server, []string{ipthc.ModeSubs}, &prev)
+	runner.Out, _ = NewResultWriter(FormatNDJSON, &prev, false)
+	runner.Run(context.Background(), strings.NewReader("example.com\n"), 1)
+	runner.Out.Close()
+
+	baseline, err := readBaseline(bufio.NewReader(&prev))
+	if err != nil {
+		t.Fatalf("readBaseline failed: %v", err)
+	}
+
+	// Second run sees one result replaced
+	results = "b.example.com\nc.example.com"
+	var buf bytes.Buffer
+	runner = newTestRunner(t, server, []string{ipthc.ModeSubs}, &buf)
+	runner.Diff = NewDiffWriter(runner.Out, baseline)
+	runner.Out = runner.Diff
+	runner.Run(context.Background(), strings.NewReader("example.com\n"), 2)
+	runner.Out.Close()
+
+	want := []string{
+		"+\tsubs\texample.com\tc.example.com",
+		"-\tsubs\texample.com\ta.example.com",
+	}
+	if got := strings.Split(strings.TrimSpace(buf.String()), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRunner_DiffSkipsRemovalsForResumedQuery(t *testing.T) {
+	server := pagedServer(t, 2, make(map[string]int))
+
+	// A previous run stopped after page 1 of example.com
+	state, err := OpenStateJournal(filepath.Join(t.TempDir(), "state.jsonl"))
+	if err != nil {
+		t.Fatalf("OpenStateJournal failed: %v", err)
+	}
+	defer state.Close()
+	state.Record(ipthc.ModeSubs, "example.com", ipthc.Checkpoint{Page: 1, Total: 4, Fetched: 2, NextPageURL: server.URL + "/sb/example.com?page=2"})
+
+	baseline := newBaseline()
+	baseline.add(ipthc.ModeSubs, "example.com", "sub1-a.example.com")
+	baseline.add(ipthc.ModeSubs, "example.com", "sub1-b.example.com")
+	baseline.add(ipthc.ModeSubs, "example.com", "sub2-a.example.com")
+
+	var buf bytes.Buffer
+	runner := newTestRunner(t, server, []string{ipthc.ModeSubs}, &buf)
+	runner.State = state
+	runner.Diff = NewDiffWriter(runner.Out, baseline)
+	runner.Out = runner.Diff
+	runner.Run(context.Background(), strings.NewReader("example.com\n"), 1)
+	runner.Out.Close()
+
+	// Page 1 was not fetched again, so its results must not show up as removed
+	if want := "+\tsubs\texample.com\tsub2-b.example.com\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestRunner_DiffIgnoresOutOfScopeBaseline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(";;Entries: 2/2\nwww.example.com\nshop.other.net"))
+	}))
+	defer server.Close()
+
+	// The baseline was recorded without -scope
+	baseline := newBaseline()
+	baseline.add(ipthc.ModeDNS, "1.1.1.1", "www.example.com")
+	baseline.add(ipthc.ModeDNS, "1.1.1.1", "shop.other.net")
+	baseline.add(ipthc.ModeDNS, "1.1.1.1", "old.other.net")
+
+	include := &ScopeList{}
+	include.Add("*.example.com")
+	scope := &Scope{Include: include}
+	baseline.Restrict(scope)
+
+	var buf bytes.Buffer
+	runner := newTestRunner(t, server, []string{ipthc.ModeDNS}, &buf)
+	runner.Scope = scope
+	runner.Diff = NewDiffWriter(runner.Out, baseline)
+	runner.Out = runner.Diff
+	runner.Run(context.Background(), strings.NewReader("1.1.1.1\n"), 1)
+	runner.Out.Close()
+
+	// Filtered results are not changes in either direction
+	if buf.Len() != 0 || runner.Diff.Changes() != 0 {
+		t.Errorf("expected no changes, got %q", buf.String())
+	}
+	if baseline.Len() != 1 {
+		t.Errorf("restricted baseline has %d results, want 1", baseline.Len())
+	}
+}
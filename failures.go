@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+// FailureClass groups failed queries by cause, ordered from least to most
+// severe. The exit code of a run is that of its worst failure class.
+type FailureClass int
+
+const (
+	FailureOther        FailureClass = iota // Anything not classified below (output or state errors)
+	FailureInvalidInput                     // Malformed input line, range too large
+	FailureRateLimited                      // HTTP 429 after retries, or the API quota ran out
+	FailureHTTPStatus                       // Any other non-200 response after retries
+	FailureNetwork                          // The API could not be reached
+	numFailureClasses
+)
+
+var failureClassNames = [numFailureClasses]string{
+	FailureOther:        "other",
+	FailureInvalidInput: "invalid input",
+	FailureRateLimited:  "rate limited",
+	FailureHTTPStatus:   "HTTP status",
+	FailureNetwork:      "network",
+}
+
+var failureExitCodes = [numFailureClasses]int{
+	FailureOther:        exitFailure,
+	FailureInvalidInput: exitInvalidInput,
+	FailureRateLimited:  exitRateLimited,
+	FailureHTTPStatus:   exitHTTPStatus,
+	FailureNetwork:      exitNetwork,
+}
+
+func (c FailureClass) String() string {
+	return failureClassNames[c]
+}
+
+// ExitCode returns the process exit code for a run whose worst failure is c
+func (c FailureClass) ExitCode() int {
+	return failureExitCodes[c]
+}
+
+// classifyFailure maps an error to its failure class
+// ErrRateLimited is checked before ErrHTTPStatus since a 429 matches both
+func classifyFailure(err error) FailureClass {
+	switch {
+	case errors.Is(err, ipthc.ErrInvalidInput):
+		return FailureInvalidInput
+	case errors.Is(err, ipthc.ErrRateLimited):
+		return FailureRateLimited
+	case errors.Is(err, ipthc.ErrHTTPStatus):
+		return FailureHTTPStatus
+	case errors.Is(err, ipthc.ErrNetwork):
+		return FailureNetwork
+	default:
+		return FailureOther
+	}
+}
+
+// exitCode returns the exit code of a finished run: the highest of the codes
+// that apply to it, or 0 if none do. diff is nil unless -diff is in use.
+//
+// Without -diff, failures exit with the code of their worst class and
+// truncation with exitTruncated. With -diff the run exits like diff(1):
+// exitDiffChanged for changes and exitDiffTrouble instead of exitFailure for
+// unclassified failures. Truncation is left to the marker and the summary
+// there, so it never hides whether anything changed.
+func exitCode(r *Runner, diff *DiffWriter) int {
+	code := 0
+	if worst, failed := r.WorstFailure(); failed {
+		code = worst.ExitCode()
+		if diff != nil && worst == FailureOther {
+			code = exitDiffTrouble
+		}
+	}
+	if diff == nil && r.Truncated() > 0 {
+		code = max(code, exitTruncated)
+	}
+	if diff != nil && diff.Changes() > 0 {
+		code = max(code, exitDiffChanged)
+	}
+	return code
+}
+
+// formatFailures summarizes per-class failure counts, most severe first,
+// e.g. "2 network, 1 invalid input"
+func formatFailures(counts [numFailureClasses]int64) string {
+	var parts []string
+	for c := numFailureClasses - 1; c >= 0; c-- {
+		if counts[c] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[c], c))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want FailureClass
+	}{
+		{ipthc.ValidateIP("not.an.ip"), FailureInvalidInput},
+		{fmt.Errorf("page 2: %w", &ipthc.StatusError{StatusCode: http.StatusTooManyRequests}), FailureRateLimited},
+		{ipthc.ErrQuotaExhausted, FailureRateLimited},
+		{&ipthc.StatusError{StatusCode: http.StatusNotFound}, FailureHTTPStatus},
+		{fmt.Errorf("wrapped: %w", ipthc.ErrNetwork), FailureNetwork},
+		{errors.New("disk full"), FailureOther},
+	}
+
+	for _, tt := range tests {
+		if got := classifyFailure(tt.err); got != tt.want {
+			t.Errorf("classifyFailure(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestFailureClass_ExitCodes(t *testing.T) {
+	want := map[FailureClass]int{
+		FailureOther:        exitFailure,
+		FailureInvalidInput: exitInvalidInput,
+		FailureRateLimited:  exitRateLimited,
+		FailureHTTPStatus:   exitHTTPStatus,
+		FailureNetwork:      exitNetwork,
+	}
+	for c, code := range want {
+		if c.ExitCode() != code {
+			t.Errorf("%s.ExitCode() = %d, want %d", c, c.ExitCode(), code)
+		}
+	}
+}
+
+func TestFormatFailures(t *testing.T) {
+	var counts [numFailureClasses]int64
+	counts[FailureInvalidInput] = 3
+	counts[FailureNetwork] = 1
+
+	if got := formatFailures(counts); got != "1 network, 3 invalid input" {
+		t.Errorf("formatFailures() = %q", got)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  []error
+		truncated bool
+		diff      bool
+		changed   bool
+		want      int
+	}{
+		{"clean", nil, false, false, false, 0},
+		{"worst class wins", []error{ipthc.ErrNetwork, ipthc.ValidateIP("x")}, false, false, false, exitNetwork},
+		{"truncated", nil, true, false, false, exitTruncated},
+		{"unclassified and truncated", []error{errors.New("disk full")}, true, false, false, exitTruncated},
+		{"classified and truncated", []error{ipthc.ValidateIP("x")}, true, false, false, exitInvalidInput},
+		{"diff unchanged", nil, false, true, false, 0},
+		{"diff changed", nil, false, true, true, exitDiffChanged},
+		{"diff changed and truncated", nil, true, true, true, exitDiffChanged},
+		{"diff truncated", nil, true, true, false, 0},
+		{"diff unclassified", []error{errors.New("disk full")}, false, true, true, exitDiffTrouble},
+		{"diff classified", []error{ipthc.ErrNetwork}, false, true, true, exitNetwork},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runner{}
+			for _, err := range tt.failures {
+				r.countFailure(err)
+			}
+			if tt.truncated {
+				r.truncated.Add(1)
+			}
+			var diff *DiffWriter
+			if tt.diff {
+				diff = NewDiffWriter(nil, newBaseline())
+				if tt.changed {
+					diff.added = 1
+				}
+			}
+			if got := exitCode(r, diff); got != tt.want {
+				t.Errorf("exitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
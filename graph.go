@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+// Node and edge types
+const (
+	NodeIP     = "ip"
+	NodeDomain = "domain"
+	NodeRange  = "range"
+
+	EdgePTR       = "ptr"       // IP -> hostname (dns)
+	EdgeSubdomain = "subdomain" // domain -> subdomain (subs)
+	EdgeCNAME     = "cname"     // target -> domain pointing at it (cname)
+	EdgeContains  = "contains"  // CIDR block or range -> IP
+	EdgePivot     = "pivot"     // Input -> query derived from its results (-recurse), labelled with the mode
+)
+
+// GraphNode is a typed vertex
+type GraphNode struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// GraphEdge is a typed, directed edge
+type GraphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+	Label  string `json:"label,omitempty"` // Defaults to Type when empty
+}
+
+func (e GraphEdge) label() string {
+	if e.Label != "" {
+		return e.Label
+	}
+	return e.Type
+}
+
+// Graph accumulates the relationships between inputs and results over a run.
+// It implements ResultWriter and writes itself to a file on Close, in DOT,
+// GraphML or JSON format depending on the file extension.
+type Graph struct {
+	mu    sync.Mutex
+	path  string
+	nodes map[string]string // id -> type
+	edges map[GraphEdge]bool
+}
+
+// NewGraph creates an empty graph that will be written to path
+func NewGraph(path string) (*Graph, error) {
+	if graphFormat(path) == "" {
+		return nil, fmt.Errorf("unsupported graph format: %s (use .dot, .graphml or .json)", path)
+	}
+	return &Graph{
+		path:  path,
+		nodes: make(map[string]string),
+		edges: make(map[GraphEdge]bool),
+	}, nil
+}
+
+func graphFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".dot", ".gv":
+		return "dot"
+	case ".graphml":
+		return "graphml"
+	case ".json":
+		return "json"
+	default:
+		return ""
+	}
+}
+
+// nodeType returns the node type for a result or domain-mode input
+func nodeType(value string) string {
+	if ipthc.ValidateIP(value) == nil {
+		return NodeIP
+	}
+	return NodeDomain
+}
+
+// Write records the edge represented by a result
+func (g *Graph) Write(r Result) error {
+	if r.IsMarker() {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var edgeType, inputType string
+	switch r.Mode {
+	case ipthc.ModeDNS:
+		edgeType, inputType = EdgePTR, NodeIP
+	case ipthc.ModeSubs:
+		edgeType, inputType = EdgeSubdomain, NodeDomain
+	case ipthc.ModeCNAME:
+		edgeType, inputType = EdgeCNAME, NodeDomain
+	default:
+		return nil
+	}
+
+	g.addNode(r.Input, inputType)
+	g.addNode(r.Result, nodeType(r.Result))
+	g.edges[GraphEdge{Source: r.Input, Target: r.Result, Type: edgeType}] = true
+
+	if r.Range != "" {
+		g.addNode(r.Range, NodeRange)
+		g.edges[GraphEdge{Source: r.Range, Target: r.Input, Type: EdgeContains}] = true
+	}
+
+	// Link a recursive query back to the input whose results it came from
+	if r.From != "" {
+		g.addNode(r.From, nodeType(r.From))
+		g.edges[GraphEdge{Source: r.From, Target: r.Input, Type: EdgePivot, Label: r.Mode}] = true
+	}
+
+	return nil
+}
+
+// addNode adds a node, keeping the first type seen for it
+// Caller must hold g.mu
+func (g *Graph) addNode(id, nodeType string) {
+	if _, ok := g.nodes[id]; !ok {
+		g.nodes[id] = nodeType
+	}
+}
+
+// Nodes returns all nodes sorted by ID
+func (g *Graph) Nodes() []GraphNode {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	nodes := make([]GraphNode, 0, len(g.nodes))
+	for id, t := range g.nodes {
+		nodes = append(nodes, GraphNode{ID: id, Type: t})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// Edges returns all edges sorted by source, target, type and label
+func (g *Graph) Edges() []GraphEdge {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	edges := make([]GraphEdge, 0, len(g.edges))
+	for e := range g.edges {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Source != edges[j].Source {
+			return edges[i].Source < edges[j].Source
+		}
+		if edges[i].Target != edges[j].Target {
+			return edges[i].Target < edges[j].Target
+		}
+		if edges[i].Type != edges[j].Type {
+			return edges[i].Type < edges[j].Type
+		}
+		return edges[i].Label < edges[j].Label
+	})
+	return edges
+}
+
+// Close writes the graph to its file
+func (g *Graph) Close() error {
+	file, err := os.Create(g.path)
+	if err != nil {
+		return fmt.Errorf("failed to create graph file: %w", err)
+	}
+
+	w := bufio.NewWriter(file)
+	switch graphFormat(g.path) {
+	case "dot":
+		err = g.WriteDOT(w)
+	case "graphml":
+		err = g.WriteGraphML(w)
+	case "json":
+		err = g.WriteJSON(w)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write graph: %w", err)
+	}
+	return nil
+}
+
+// WriteDOT writes the graph in Graphviz DOT format
+func (g *Graph) WriteDOT(w io.Writer) error {
+	shapes := map[string]string{NodeIP: "box", NodeDomain: "ellipse", NodeRange: "folder"}
+
+	fmt.Fprintln(w, "digraph ipthc {")
+	for _, n := range g.Nodes() {
+		fmt.Fprintf(w, "  %s [type=%s, shape=%s];\n", dotQuote(n.ID), dotQuote(n.Type), shapes[n.Type])
+	}
+	for _, e := range g.Edges() {
+		fmt.Fprintf(w, "  %s -> %s [type=%s, label=%s];\n", dotQuote(e.Source), dotQuote(e.Target), dotQuote(e.Type), dotQuote(e.label()))
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// WriteGraphML writes the graph in GraphML format (Gephi, yEd, Maltego)
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	fmt.Fprintln(w, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(w, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(w, `  <key id="ntype" for="node" attr.name="type" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="etype" for="edge" attr.name="type" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="elabel" for="edge" attr.name="label" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <graph id="ipthc" edgedefault="directed">`)
+	for _, n := range g.Nodes() {
+		fmt.Fprintf(w, "    <node id=\"%s\"><data key=\"ntype\">%s</data></node>\n", xmlEscape(n.ID), xmlEscape(n.Type))
+	}
+	for i, e := range g.Edges() {
+		fmt.Fprintf(w, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\"><data key=\"etype\">%s</data><data key=\"elabel\">%s</data></edge>\n",
+			i, xmlEscape(e.Source), xmlEscape(e.Target), xmlEscape(e.Type), xmlEscape(e.label()))
+	}
+	fmt.Fprintln(w, "  </graph>")
+	_, err := fmt.Fprintln(w, "</graphml>")
+	return err
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// WriteJSON writes the graph as {"nodes": [...], "edges": [...]}
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Nodes []GraphNode `json:"nodes"`
+		Edges []GraphEdge `json:"edges"`
+	}{g.Nodes(), g.Edges()})
+}
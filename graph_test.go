@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+// sampleGraph builds a graph with one result from every mode
+func sampleGraph(t *testing.T, path string) *Graph {
+	t.Helper()
+	g, err := NewGraph(path)
+	if err != nil {
+		t.Fatalf("NewGraph failed: %v", err)
+	}
+	g.Write(Result{Mode: ipthc.ModeDNS, Input: "10.0.0.1", Result: "www.example.com", Range: "10.0.0.0/30"})
+	g.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "www.example.com"})
+	g.Write(Result{Mode: ipthc.ModeCNAME, Input: "example.herokuapp.com", Result: "shop.example.com"})
+	g.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "www.example.com"}) // duplicate
+	return g
+}
+
+func TestGraph_NodesAndEdges(t *testing.T) {
+	g := sampleGraph(t, "graph.json")
+
+	expectedNodes := []GraphNode{
+		{ID: "10.0.0.0/30", Type: NodeRange},
+		{ID: "10.0.0.1", Type: NodeIP},
+		{ID: "example.com", Type: NodeDomain},
+		{ID: "example.herokuapp.com", Type: NodeDomain},
+		{ID: "shop.example.com", Type: NodeDomain},
+		{ID: "www.example.com", Type: NodeDomain},
+	}
+	nodes := g.Nodes()
+	if len(nodes) != len(expectedNodes) {
+		t.Fatalf("got %d nodes, want %d: %+v", len(nodes), len(expectedNodes), nodes)
+	}
+	for i := range expectedNodes {
+		if nodes[i] != expectedNodes[i] {
+			t.Errorf("node[%d] = %+v, want %+v", i, nodes[i], expectedNodes[i])
+		}
+	}
+
+	expectedEdges := []GraphEdge{
+		{Source: "10.0.0.0/30", Target: "10.0.0.1", Type: EdgeContains},
+		{Source: "10.0.0.1", Target: "www.example.com", Type: EdgePTR},
+		{Source: "example.com", Target: "www.example.com", Type: EdgeSubdomain},
+		{Source: "example.herokuapp.com", Target: "shop.example.com", Type: EdgeCNAME},
+	}
+	edges := g.Edges()
+	if len(edges) != len(expectedEdges) {
+		t.Fatalf("got %d edges, want %d: %+v", len(edges), len(expectedEdges), edges)
+	}
+	for i := range expectedEdges {
+		if edges[i] != expectedEdges[i] {
+			t.Errorf("edge[%d] = %+v, want %+v", i, edges[i], expectedEdges[i])
+		}
+	}
+}
+
+func TestGraph_WriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	sampleGraph(t, "graph.dot").WriteDOT(&buf)
+	dot := buf.String()
+
+	for _, want := range []string{
+		"digraph ipthc {",
+		`"10.0.0.1" [type="ip", shape=box];`,
+		`"10.0.0.1" -> "www.example.com" [type="ptr", label="ptr"];`,
+		`"example.herokuapp.com" -> "shop.example.com" [type="cname", label="cname"];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT output missing %q:\n%s", want, dot)
+		}
+	}
+}
+
+func TestGraph_WriteGraphML(t *testing.T) {
+	var buf bytes.Buffer
+	sampleGraph(t, "graph.graphml").WriteGraphML(&buf)
+
+	var doc struct {
+		Graph struct {
+			Nodes []struct {
+				ID string `xml:"id,attr"`
+			} `xml:"node"`
+			Edges []struct {
+				Source string `xml:"source,attr"`
+				Target string `xml:"target,attr"`
+				Data   string `xml:"data"`
+			} `xml:"edge"`
+		} `xml:"graph"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("GraphML is not valid XML: %v", err)
+	}
+	if len(doc.Graph.Nodes) != 6 || len(doc.Graph.Edges) != 4 {
+		t.Errorf("got %d nodes and %d edges", len(doc.Graph.Nodes), len(doc.Graph.Edges))
+	}
+	if doc.Graph.Edges[1].Data != EdgePTR {
+		t.Errorf("edge type = %q, want %q", doc.Graph.Edges[1].Data, EdgePTR)
+	}
+}
+
+func TestGraph_CloseWritesFileByExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	g := sampleGraph(t, path)
+	if err := g.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Nodes []GraphNode `json:"nodes"`
+		Edges []GraphEdge `json:"edges"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("graph file is not valid JSON: %v", err)
+	}
+	if len(doc.Nodes) != 6 || len(doc.Edges) != 4 {
+		t.Errorf("got %d nodes and %d edges", len(doc.Nodes), len(doc.Edges))
+	}
+}
+
+func TestNewGraph_UnsupportedExtension(t *testing.T) {
+	if _, err := NewGraph("graph.png"); err == nil {
+		t.Error("expected error for unsupported extension")
+	}
+}
+
+func TestDotQuote(t *testing.T) {
+	if got := dotQuote(`a"b\c`); got != `"a\"b\\c"` {
+		t.Errorf("dotQuote = %s", got)
+	}
+}
+
+func TestGraph_PivotEdges(t *testing.T) {
+	g, _ := NewGraph("graph.json")
+	g.Write(Result{Mode: ipthc.ModeDNS, Input: "1.1.1.1", Result: "www.example.com"})
+	g.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "api.example.com", Depth: 1, From: "1.1.1.1"})
+
+	want := GraphEdge{Source: "1.1.1.1", Target: "example.com", Type: EdgePivot, Label: ipthc.ModeSubs}
+	found := false
+	for _, e := range g.Edges() {
+		found = found || e == want
+	}
+	if !found {
+		t.Errorf("missing pivot edge %+v in %+v", want, g.Edges())
+	}
+
+	var buf bytes.Buffer
+	g.WriteDOT(&buf)
+	if line := `"1.1.1.1" -> "example.com" [type="pivot", label="subs"];`; !strings.Contains(buf.String(), line) {
+		t.Errorf("DOT output missing %q:\n%s", line, buf.String())
+	}
+}
+
+func TestGraph_RecursiveRunIsConnected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.1.1.1":
+			w.Write([]byte(";;Entries: 1/1\nwww.example.com"))
+		case "/sb/example.com":
+			w.Write([]byte(";;Entries: 2/2\napi.example.com\nmail.example.org"))
+		case "/sb/example.org":
+			w.Write([]byte(";;Entries: 1/1\nshop.example.org"))
+		default:
+			w.Write([]byte(";;Entries: 0/0"))
+		}
+	}))
+	defer server.Close()
+
+	g, _ := NewGraph("graph.json")
+	runner := newTestRunner(t, server, []string{ipthc.ModeDNS}, new(bytes.Buffer))
+	runner.Out = g
+	runner.MaxDepth = 2
+	if err := runner.Run(context.Background(), strings.NewReader("1.1.1.1\n"), 2); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// Walk the edges in both directions from the seed
+	adjacent := make(map[string][]string)
+	for _, e := range g.Edges() {
+		adjacent[e.Source] = append(adjacent[e.Source], e.Target)
+		adjacent[e.Target] = append(adjacent[e.Target], e.Source)
+	}
+	reached := map[string]bool{"1.1.1.1": true}
+	queue := []string{"1.1.1.1"}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, next := range adjacent[id] {
+			if !reached[next] {
+				reached[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	nodes := g.Nodes()
+	if len(nodes) != 7 {
+		t.Errorf("got %d nodes, want 7: %+v", len(nodes), nodes)
+	}
+	for _, n := range nodes {
+		if !reached[n.ID] {
+			t.Errorf("node %s is not connected to the seed", n.ID)
+		}
+	}
+}
@@ -2,97 +2,324 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/DFC302/ipthc/pkg/ipthc/ipthctest"
 )
 
-func TestIntegration_DNSMode(t *testing.T) {
+// cliPath is the CLI binary built once by TestMain, or "" in -short mode
+var cliPath string
+
+// TestMain builds the CLI once for every integration test
+func TestMain(m *testing.M) {
+	flag.Parse()
 	if testing.Short() {
-		t.Skip("skipping integration test")
+		os.Exit(m.Run())
 	}
 
-	// Build binary
-	cmd := exec.Command("go", "build", "-o", "ipthc-test")
-	if err := cmd.Run(); err != nil {
-		t.Fatalf("failed to build: %v", err)
+	dir, err := os.MkdirTemp("", "ipthc-test")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create build directory: %v\n", err)
+		os.Exit(1)
 	}
-	defer os.Remove("ipthc-test")
+	cliPath = filepath.Join(dir, "ipthc-test")
+	if out, err := exec.Command("go", "build", "-o", cliPath).CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to build: %v\n%s", err, out)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
 
-	// Test with echo
-	input := "1.1.1.1"
-	cmd = exec.Command("./ipthc-test", "-dns")
+// testBinary returns the CLI built by TestMain, skipping integration tests
+// in -short mode
+func testBinary(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	return cliPath
+}
+
+// runCLI runs the binary against server in a scratch directory and returns
+// its stdout, stderr and exit code
+func runCLI(t *testing.T, bin string, server *ipthctest.Server, input string, args ...string) (string, string, int) {
+	t.Helper()
+	args = append([]string{"-base-url", server.URL, "-no-cache", "-r", "0"}, args...)
+	cmd := exec.Command(bin, args...)
+	cmd.Dir = t.TempDir()
 	cmd.Stdin = strings.NewReader(input)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	_ = cmd.Run()
-	// May fail if API is down, but we're testing the flow
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatalf("failed to run: %v", err)
+	}
+	return stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+func TestIntegration_DNSMode(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	server.AddDNS("1.1.1.1", "one.one.one.one", "1dot1dot1dot1.cloudflare-dns.com")
+
+	stdout, stderr, code := runCLI(t, testBinary(t), server, "1.1.1.1\n", "-dns")
 
-	t.Logf("stdout: %s", stdout.String())
-	t.Logf("stderr: %s", stderr.String())
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr: %s", code, stderr)
+	}
+	if want := "one.one.one.one\n1dot1dot1dot1.cloudflare-dns.com\n"; stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
 }
 
 func TestIntegration_SubsMode(t *testing.T) {
-	if testing.Short() {
-		t.Skip("skipping integration test")
+	server := ipthctest.NewServer()
+	defer server.Close()
+	var subs []string
+	for i := 1; i <= 250; i++ {
+		subs = append(subs, fmt.Sprintf("sub%d.example.com", i))
 	}
+	server.AddSubdomains("example.com", subs...)
 
-	cmd := exec.Command("go", "build", "-o", "ipthc-test")
-	if err := cmd.Run(); err != nil {
-		t.Fatalf("failed to build: %v", err)
+	stdout, stderr, code := runCLI(t, testBinary(t), server, "example.com\n", "-subs", "-v")
+
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr: %s", code, stderr)
+	}
+	if got := strings.Fields(stdout); len(got) != 250 || got[249] != "sub250.example.com" {
+		t.Errorf("expected all 250 subdomains across 3 pages, got %d", len(got))
+	}
+	if len(server.Requests()) != 3 {
+		t.Errorf("expected 3 page requests, got %v", server.Requests())
 	}
-	defer os.Remove("ipthc-test")
 
-	input := "example.com"
-	cmd = exec.Command("./ipthc-test", "-subs", "-v")
-	cmd.Stdin = strings.NewReader(input)
+	// Verbose mode shows the API's comment lines
+	if !strings.Contains(stderr, ";;Entries: 100/250") {
+		t.Errorf("verbose mode should show comment lines, got: %s", stderr)
+	}
+}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+func TestIntegration_RetriesTransientFailures(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	server.AddDNS("1.1.1.1", "one.one.one.one")
+	server.Inject(ipthctest.Fault{Status: 502}, ipthctest.Fault{Status: 429})
 
-	cmd.Run()
+	stdout, stderr, code := runCLI(t, testBinary(t), server, "1.1.1.1\n", "-dns", "-retries", "2", "-retry-max-wait", "10ms")
+
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr: %s", code, stderr)
+	}
+	if stdout != "one.one.one.one\n" {
+		t.Errorf("unexpected stdout: %q", stdout)
+	}
+}
+
+func TestIntegration_RecordReplay(t *testing.T) {
+	server := ipthctest.NewServer()
+	server.AddSubdomains("example.com", "a.example.com", "b.example.com", "c.example.com")
+	server.SetPageSize(2)
+	server.Inject(ipthctest.Fault{}, ipthctest.Fault{Status: 503})
 
-	t.Logf("stdout: %s", stdout.String())
-	t.Logf("stderr: %s", stderr.String())
+	bin := testBinary(t)
+	dir := t.TempDir()
+	recorded, stderr, code := runCLI(t, bin, server, "example.com\n", "-subs", "-retries", "1", "-retry-max-wait", "10ms", "-record", dir)
+	if code != 0 {
+		t.Fatalf("recording run: exit code %d, stderr: %s", code, stderr)
+	}
+	server.Close()
+
+	// The server is gone, so everything has to come from the recording
+	replayed, stderr, code := runCLI(t, bin, server, "example.com\n", "-subs", "-retries", "1", "-retry-max-wait", "10ms", "-replay", dir)
+	if code != 0 {
+		t.Fatalf("replay run: exit code %d, stderr: %s", code, stderr)
+	}
+	if replayed != recorded || replayed != "a.example.com\nb.example.com\nc.example.com\n" {
+		t.Errorf("replayed %q, recorded %q", replayed, recorded)
+	}
 
-	// Verify stderr contains comment lines in verbose mode
-	if !strings.Contains(stderr.String(), ";;") {
-		t.Logf("verbose mode may not be showing comments (API might have changed)")
+	// Inputs that were never recorded fail instead of going to the network
+	_, _, code = runCLI(t, bin, server, "example.org\n", "-subs", "-replay", dir)
+	if code != 1 {
+		t.Errorf("expected exit code 1 for an unrecorded input, got %d", code)
 	}
 }
 
-func TestIntegration_InvalidInput(t *testing.T) {
-	cmd := exec.Command("go", "build", "-o", "ipthc-test")
-	if err := cmd.Run(); err != nil {
-		t.Fatalf("failed to build: %v", err)
+func TestIntegration_MaxPages(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	server.AddSubdomains("example.com", "a.example.com", "b.example.com", "c.example.com")
+	server.SetPageSize(1)
+
+	bin := testBinary(t)
+	stdout, stderr, code := runCLI(t, bin, server, "example.com\n", "-subs", "-max-pages", "2")
+	if code != 3 {
+		t.Errorf("expected exit code 3 for a truncated query, got %d (stderr: %s)", code, stderr)
+	}
+	if stdout != "a.example.com\nb.example.com\n" {
+		t.Errorf("expected the first 2 pages, got %q", stdout)
+	}
+	if !strings.Contains(stderr, "Truncated 1 query(s)") {
+		t.Errorf("expected a truncation summary, got: %s", stderr)
 	}
-	defer os.Remove("ipthc-test")
-	defer os.Remove("ipthc-errors.log")
 
-	input := "not.an.ip"
-	cmd = exec.Command("./ipthc-test", "-dns")
-	cmd.Stdin = strings.NewReader(input)
+	stdout, stderr, code = runCLI(t, bin, server, "example.com\n", "-subs", "-max-pages", "0")
+	if code != 0 || strings.Count(stdout, "\n") != 3 {
+		t.Errorf("unlimited pages: exit code %d, stdout %q, stderr: %s", code, stdout, stderr)
+	}
+}
+
+func TestIntegration_DiffExitCodeIgnoresTruncation(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	server.AddSubdomains("example.com", "a.example.com", "b.example.com", "c.example.com")
+	server.SetPageSize(1)
+
+	dir := t.TempDir()
+	unchanged := filepath.Join(dir, "unchanged.ndjson")
+	os.WriteFile(unchanged, []byte(`{"mode":"subs","input":"example.com","result":"a.example.com"}
+{"mode":"subs","input":"example.com","result":"b.example.com"}
+`), 0644)
+	empty := filepath.Join(dir, "empty.ndjson")
+	os.WriteFile(empty, nil, 0644)
+
+	bin := testBinary(t)
+	tests := []struct {
+		baseline string
+		code     int
+	}{
+		{unchanged, 0},
+		{empty, 1},
+	}
+	for _, tt := range tests {
+		_, stderr, code := runCLI(t, bin, server, "example.com\n", "-subs", "-max-pages", "2", "-diff", tt.baseline)
+		if code != tt.code {
+			t.Errorf("%s: expected exit code %d, got %d (stderr: %s)", filepath.Base(tt.baseline), tt.code, code, stderr)
+		}
+		if !strings.Contains(stderr, "Truncated 1 query(s)") {
+			t.Errorf("%s: truncation should still be reported, got: %s", filepath.Base(tt.baseline), stderr)
+		}
+	}
+}
+
+func TestIntegration_QuotaStop(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	for _, ip := range []string{"1.1.1.1", "1.1.1.2", "1.1.1.3"} {
+		server.AddDNS(ip, "host-"+ip)
+	}
+	server.SetQuota(2)
+
+	stdout, stderr, code := runCLI(t, testBinary(t), server, "1.1.1.1\n1.1.1.2\n1.1.1.3\n", "-dns", "-quota-stop", "-quota-low", "0")
+
+	if code != exitRateLimited {
+		t.Errorf("expected exit code %d once the quota ran out, got %d", exitRateLimited, code)
+	}
+	if stdout != "host-1.1.1.1\nhost-1.1.1.2\n" {
+		t.Errorf("expected the 2 queries within quota, got %q", stdout)
+	}
+	if !strings.Contains(stderr, "API quota exhausted") {
+		t.Errorf("expected quota message, got: %s", stderr)
+	}
+	if len(server.Requests()) != 2 {
+		t.Errorf("no request should be made once the quota is gone, got %v", server.Requests())
+	}
+}
+
+func TestIntegration_InvalidInput(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+
+	bin := testBinary(t)
+	cmd := exec.Command(bin, "-dns", "-base-url", server.URL, "-no-cache")
+	cmd.Dir = t.TempDir()
+	cmd.Stdin = strings.NewReader("not.an.ip")
 
 	err := cmd.Run()
 
-	// Should exit with code 1
-	if err == nil {
-		t.Error("expected non-zero exit code for invalid input")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != exitInvalidInput {
+		t.Errorf("expected exit code %d for invalid input, got %v", exitInvalidInput, err)
 	}
 
 	// Check error log exists
-	if _, err := os.Stat("ipthc-errors.log"); os.IsNotExist(err) {
+	if _, err := os.Stat(filepath.Join(cmd.Dir, "ipthc-errors.log")); os.IsNotExist(err) {
 		t.Error("error log file should be created")
 	}
+	if len(server.Requests()) != 0 {
+		t.Errorf("invalid input should not be queried, got %v", server.Requests())
+	}
+}
+
+func TestIntegration_WorstFailureClass(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	server.AddDNS("1.1.1.1", "one.one.one.one")
+	server.Inject(ipthctest.Fault{Status: 404})
+
+	_, stderr, code := runCLI(t, testBinary(t), server, "1.1.1.2\nnot.an.ip\n1.1.1.1\n", "-dns")
+
+	if code != exitHTTPStatus {
+		t.Errorf("expected exit code %d, got %d", exitHTTPStatus, code)
+	}
+	if !strings.Contains(stderr, "Failed 2 query(s): 1 HTTP status, 1 invalid input") {
+		t.Errorf("expected a per-class failure summary, got: %s", stderr)
+	}
+}
+
+func TestIntegration_InsecureEnv(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(";;Entries: 1/1\nok.example.com"))
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // Rejected handshakes are expected
+	server.StartTLS()
+	defer server.Close()
+
+	bin := testBinary(t)
+	run := func(value string) (string, int) {
+		cmd := exec.Command(bin, "-dns", "-base-url", server.URL, "-no-cache", "-r", "0")
+		cmd.Dir = t.TempDir()
+		cmd.Env = append(os.Environ(), "IPTHC_INSECURE="+value)
+		cmd.Stdin = strings.NewReader("1.1.1.1\n")
+		out, _ := cmd.Output()
+		return string(out), cmd.ProcessState.ExitCode()
+	}
+
+	if out, code := run("true"); code != 0 || out != "ok.example.com\n" {
+		t.Errorf("IPTHC_INSECURE=true: exit code %d, output %q", code, out)
+	}
+	// The test server's certificate is self-signed, so verification must fail
+	for _, value := range []string{"0", "false"} {
+		if _, code := run(value); code != exitNetwork {
+			t.Errorf("IPTHC_INSECURE=%s: expected verification to stay on (exit %d), got %d", value, exitNetwork, code)
+		}
+	}
+	if _, code := run("yes please"); code != exitFailure {
+		t.Errorf("invalid IPTHC_INSECURE: expected exit code %d, got %d", exitFailure, code)
+	}
 }
 
 func TestIntegration_NoModeFlag(t *testing.T) {
-	cmd := exec.Command("go", "run", ".")
+	cmd := exec.Command(testBinary(t))
 	cmd.Stdin = strings.NewReader("test")
 
 	var stderr bytes.Buffer
@@ -109,8 +336,23 @@ func TestIntegration_NoModeFlag(t *testing.T) {
 	}
 }
 
+func TestIntegration_UnknownFlagExitsOne(t *testing.T) {
+	cmd := exec.Command(testBinary(t), "-dns", "-bogus")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	cmd.Run()
+
+	if code := cmd.ProcessState.ExitCode(); code != exitFailure {
+		t.Errorf("expected exit code %d for an unknown flag, got %d", exitFailure, code)
+	}
+	if !strings.Contains(stderr.String(), "flag provided but not defined: -bogus") {
+		t.Errorf("expected the flag error on stderr, got: %s", stderr.String())
+	}
+}
+
 func TestIntegration_MultipleFlags(t *testing.T) {
-	cmd := exec.Command("go", "run", ".", "-dns", "-subs")
+	cmd := exec.Command(testBinary(t), "-dns", "-subs")
 	cmd.Stdin = strings.NewReader("test")
 
 	var stderr bytes.Buffer
@@ -126,3 +368,21 @@ func TestIntegration_MultipleFlags(t *testing.T) {
 		t.Errorf("expected multiple modes error, got: %s", stderr.String())
 	}
 }
+
+func TestIntegration_TakeoverCountsWrittenResults(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	server.AddCNAME("shop.herokuapp.com", "shop.example.com")
+
+	// The second query's result is dropped by -dedupe and must not be counted
+	stdout, stderr, code := runCLI(t, testBinary(t), server, "shop.herokuapp.com\nshop.herokuapp.com\n", "-cname", "-takeover", "-dedupe", "-v")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr: %s", code, stderr)
+	}
+	if lines := strings.Count(stdout, "\n"); lines != 1 {
+		t.Errorf("expected 1 result line, got %q", stdout)
+	}
+	if !strings.Contains(stderr, "Found 1 takeover candidate(s)") {
+		t.Errorf("candidate count should match the output, stderr: %s", stderr)
+	}
+}
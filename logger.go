@@ -3,11 +3,14 @@ package main
 import (
 	"fmt"
 	"os"
+	"sync"
 	"time"
 )
 
 // ErrorLogger handles logging errors to a file
+// Safe for concurrent use by multiple workers
 type ErrorLogger struct {
+	mu   sync.Mutex
 	file *os.File
 }
 
@@ -27,6 +30,8 @@ func (l *ErrorLogger) Log(mode, input, message string) error {
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
 	logLine := fmt.Sprintf("%s [%s] %s %s\n", timestamp, mode, input, message)
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	_, err := l.file.WriteString(logLine)
 	if err != nil {
 		return fmt.Errorf("failed to write to log: %w", err)
@@ -1,48 +1,145 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+const (
+	defaultBaseURL     = "https://ip.thc.org"
+	defaultLimit       = 0 // 0 means no limit, auto-pagination will fetch all results
+	defaultRateLimit   = 1.0
+	defaultConcurrency = 1
+	errorLogFile       = "ipthc-errors.log"
 )
 
+// Exit codes, documented in the Error Handling section of the README
+// A run that ends in several of these states exits with the highest (see exitCode)
 const (
-	defaultBaseURL   = "https://ip.thc.org"
-	defaultLimit     = 0 // 0 means no limit, auto-pagination will fetch all results
-	defaultRateLimit = 1.0
-	errorLogFile     = "ipthc-errors.log"
+	exitFailure      = 1 // Flag errors, and failures that fit no other class
+	exitDiffChanged  = 1 // With -diff: changes were found
+	exitDiffTrouble  = 2 // With -diff: the baseline could not be loaded, or failures that fit no other class
+	exitTruncated    = 3 // Every query ran but at least one hit -max-pages
+	exitInvalidInput = 4 // Malformed input lines or oversized ranges
+	exitRateLimited  = 5 // HTTP 429 after retries, or the API quota ran out
+	exitHTTPStatus   = 6 // Other non-200 responses after retries
+	exitNetwork      = 7 // The API could not be reached
+	exitInterrupted  = 130
 )
 
 func main() {
-	// Define flags
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "db" {
+		os.Exit(runDBCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "ranges" {
+		os.Exit(runRangesCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Define flags; parse errors exit 1 like every other flag error, rather
+	// than 2, which -diff uses for failed runs
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
 	dnsMode := flag.Bool("dns", false, "DNS reverse lookup mode")
 	subsMode := flag.Bool("subs", false, "Subdomain enumeration mode")
 	cnameMode := flag.Bool("cname", false, "CNAME lookup mode")
+	allMode := flag.Bool("all", false, "Run every applicable mode per input (dns for IPs, subs and cname for domains)")
+	autoMode := flag.Bool("auto", false, "Detect each line's type: IPs go to dns, domains to subs")
+	autoCNAME := flag.Bool("auto-cname", false, "With -auto, also run cname lookups for domains")
+	modeList := flag.String("modes", "", "Comma-separated modes to run per input, e.g. subs,cname")
 	verbose := flag.Bool("v", false, "Verbose mode (show API metadata and errors)")
 	limit := flag.Int("l", defaultLimit, "Results limit per request (0 for auto-pagination to fetch all)")
+	maxPages := flag.Int("max-pages", ipthc.DefaultMaxPages, "Maximum pages fetched per query before it is reported as truncated (0 for unlimited)")
 	rateLimit := flag.Float64("r", defaultRateLimit, "Rate limit delay in seconds")
+	retries := flag.Int("retries", ipthc.DefaultRetries, "Retries for transient failures (timeouts, connection errors, 5xx, 429)")
+	retryMaxWait := flag.Duration("retry-max-wait", ipthc.DefaultRetryMaxWait, "Maximum wait between retries")
+	quotaLow := flag.Int("quota-low", ipthc.DefaultQuotaLow, "Start slowing down when the API quota drops to this many requests (0 to disable)")
+	quotaPause := flag.Duration("quota-pause", ipthc.DefaultQuotaPause, "How long to pause when the API quota is exhausted")
+	quotaStop := flag.Bool("quota-stop", false, "Stop cleanly instead of pausing when the API quota is exhausted")
+	outputFormat := flag.String("o", FormatText, "Output format: text, json or ndjson")
+	maxRange := flag.Int("max-range", defaultMaxRange, "Maximum number of addresses a CIDR block or IP range may expand to")
+	recurse := flag.Int("recurse", 0, "Feed results back as new queries up to this depth (IPs to dns, apex domains to subs, CNAMEs to cname)")
+	graphFile := flag.String("graph", "", "Write a relationship graph of inputs and results to this file (.dot, .graphml or .json)")
+	dedupe := flag.Bool("dedupe", false, "Print each distinct result once per mode, across all inputs and pages")
+	dedupeBloom := flag.Int("dedupe-bloom", 0, "Dedupe with a fixed-size Bloom filter sized for this many results instead of an exact set (implies -dedupe)")
+	dedupeFP := flag.Float64("dedupe-fp", defaultDedupeFP, "False positive rate for -dedupe-bloom (results wrongly dropped as duplicates)")
+	takeover := flag.Bool("takeover", false, "Flag cname results pointing at providers known to allow subdomain takeover")
+	takeoverDB := flag.String("takeover-fingerprints", "", "Use this JSON fingerprint database for -takeover instead of the built-in one")
+	annotateCloud := flag.Bool("annotate-cloud", false, "Tag IP inputs and results with their cloud/CDN provider, region and service (see: ipthc ranges update)")
+	rangesDir := flag.String("ranges-dir", DefaultRangesDir(), "Directory of provider IP range files for -annotate-cloud")
+	scopeFile := flag.String("scope", "", "Only keep results matching this file of domains, *.wildcards, /regexes/ and CIDRs")
+	excludeFile := flag.String("exclude", "", "Drop results matching this file of domains, *.wildcards, /regexes/ and CIDRs")
+	outOfScopeFile := flag.String("out-of-scope", "", "Write results dropped by -scope/-exclude to this file (same format as -o)")
+	diffFile := flag.String("diff", "", "Only report changes against a previous run: an -o ndjson/json output file or a -db database (exit 0 = no changes, 1 = changes, 2 = unclassified failures, 4-7 as without -diff)")
+	dbFile := flag.String("db", "", "Record every result in this SQLite database with first-seen/last-seen times (see: ipthc db query)")
+	stateFile := flag.String("state", "", "State file for resumable runs (records completed inputs and pagination progress)")
+	cacheDir := flag.String("cache-dir", ipthc.DefaultCacheDir(), "Directory for cached API responses")
+	cacheTTL := flag.Duration("cache-ttl", ipthc.DefaultCacheTTL, "How long cached API responses stay valid")
+	noCache := flag.Bool("no-cache", false, "Disable the response cache")
+	refresh := flag.Bool("refresh", false, "Ignore cached responses but store fresh ones")
+	recordDir := flag.String("record", "", "Save every raw API response with its URL and headers to this directory (disables the cache)")
+	replayDir := flag.String("replay", "", "Serve the run from responses saved with -record instead of the network (disables the cache and rate limit)")
+	baseURL := flag.String("base-url", envOr("IPTHC_BASE_URL", defaultBaseURL), "API base URL (env IPTHC_BASE_URL)")
+	proxy := flag.String("proxy", envOr("IPTHC_PROXY", ""), "HTTP(S) or SOCKS5 proxy URL, e.g. socks5://127.0.0.1:1080 (env IPTHC_PROXY, falls back to HTTP(S)_PROXY)")
+	caCert := flag.String("ca-cert", envOr("IPTHC_CA_CERT", ""), "PEM bundle of additional CA certificates to trust (env IPTHC_CA_CERT)")
+	clientCert := flag.String("client-cert", envOr("IPTHC_CLIENT_CERT", ""), "PEM client certificate for mutual TLS (env IPTHC_CLIENT_CERT)")
+	clientKey := flag.String("client-key", envOr("IPTHC_CLIENT_KEY", ""), "PEM private key for -client-cert (env IPTHC_CLIENT_KEY)")
+	insecureDefault, err := envBool("IPTHC_INSECURE")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	insecure := flag.Bool("insecure", insecureDefault, "Skip TLS certificate verification (env IPTHC_INSECURE)")
+	concurrency := flag.Int("c", defaultConcurrency, "Number of concurrent workers (all share the -r rate limit)")
 
-	flag.Parse()
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(0)
+		}
+		os.Exit(exitFailure)
+	}
 
 	// Validate flags
 	modeCount := 0
-	var mode string
+	var modes []string
 	if *dnsMode {
 		modeCount++
-		mode = "dns"
+		modes = []string{ipthc.ModeDNS}
 	}
 	if *subsMode {
 		modeCount++
-		mode = "subs"
+		modes = []string{ipthc.ModeSubs}
 	}
 	if *cnameMode {
 		modeCount++
-		mode = "cname"
+		modes = []string{ipthc.ModeCNAME}
+	}
+	if *allMode {
+		modeCount++
+		modes = AllModes
+	}
+	if *autoMode {
+		modeCount++
+		modes = AutoModes(*autoCNAME)
+	}
+	if *modeList != "" {
+		modeCount++
+		parsed, err := ParseModes(*modeList)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		modes = parsed
 	}
 
 	if modeCount == 0 {
-		fmt.Fprintln(os.Stderr, "Error: must specify one mode: -dns, -subs, or -cname")
+		fmt.Fprintln(os.Stderr, "Error: must specify one mode: -dns, -subs, -cname, -all, -auto, or -modes")
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -53,6 +150,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *autoCNAME && !*autoMode {
+		fmt.Fprintln(os.Stderr, "Error: -auto-cname requires -auto")
+		os.Exit(1)
+	}
+
 	if *limit < 0 {
 		fmt.Fprintln(os.Stderr, "Error: limit cannot be negative")
 		os.Exit(1)
@@ -63,91 +165,400 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Initialize components
-	logger, err := NewErrorLogger(errorLogFile)
+	if *retries < 0 {
+		fmt.Fprintln(os.Stderr, "Error: retries cannot be negative")
+		os.Exit(1)
+	}
+
+	if *retryMaxWait <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: retry max wait must be positive")
+		os.Exit(1)
+	}
+
+	if *quotaLow < 0 {
+		fmt.Fprintln(os.Stderr, "Error: quota low threshold cannot be negative")
+		os.Exit(1)
+	}
+
+	if *recurse < 0 {
+		fmt.Fprintln(os.Stderr, "Error: recursion depth cannot be negative")
+		os.Exit(1)
+	}
+
+	if *maxPages < 0 {
+		fmt.Fprintln(os.Stderr, "Error: max pages cannot be negative")
+		os.Exit(1)
+	}
+
+	if *maxRange < 1 {
+		fmt.Fprintln(os.Stderr, "Error: max range must be at least 1")
+		os.Exit(1)
+	}
+
+	if *cacheTTL <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: cache TTL must be positive")
+		os.Exit(1)
+	}
+
+	apiURL, err := ipthc.ValidateBaseURL(*baseURL)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to initialize error logger: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-	defer logger.Close()
 
-	client := NewAPIClient(defaultBaseURL, *limit, *rateLimit, *verbose)
+	httpClient, err := ipthc.NewHTTPClient(ipthc.TransportConfig{
+		Proxy:      *proxy,
+		CACert:     *caCert,
+		ClientCert: *clientCert,
+		ClientKey:  *clientKey,
+		Insecure:   *insecure,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *recordDir != "" && *replayDir != "" {
+		fmt.Fprintln(os.Stderr, "Error: -record and -replay cannot be used together")
+		os.Exit(1)
+	}
 
-	// Callback to stream results as they arrive
-	callback := func(results []string, currentPage int, totalResults int) error {
-		for _, data := range results {
-			fmt.Println(data)
+	if *recordDir != "" {
+		httpClient.Transport, err = ipthc.NewRecorder(*recordDir, httpClient.Transport)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *replayDir != "" {
+		httpClient.Transport, err = ipthc.NewReplayer(*replayDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
-		return nil
 	}
 
-	// Process stdin
-	scanner := bufio.NewScanner(os.Stdin)
-	failureCount := 0
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "Error: concurrency must be at least 1")
+		os.Exit(1)
+	}
+
+	if *dedupeBloom < 0 {
+		fmt.Fprintln(os.Stderr, "Error: dedupe bloom capacity cannot be negative")
+		os.Exit(1)
+	}
 
-	for scanner.Scan() {
-		input := SanitizeInput(scanner.Text())
+	if *dedupeFP <= 0 || *dedupeFP >= 1 {
+		fmt.Fprintln(os.Stderr, "Error: dedupe false positive rate must be between 0 and 1")
+		os.Exit(1)
+	}
 
-		// Skip empty lines and comments
-		if input == "" || input[0] == '#' {
-			continue
+	var fingerprints Fingerprints
+	if *takeover {
+		if !slices.Contains(modes, ipthc.ModeCNAME) {
+			fmt.Fprintln(os.Stderr, "Error: -takeover needs cname results (use -cname, -all, -auto -auto-cname or -modes with cname)")
+			os.Exit(1)
+		}
+		if fingerprints, err = LoadFingerprints(*takeoverDB); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
+	} else if *takeoverDB != "" {
+		fmt.Fprintln(os.Stderr, "Error: -takeover-fingerprints requires -takeover")
+		os.Exit(1)
+	}
 
-		// Validate and query based on mode
-		var err error
+	var cloudRanges *CloudRanges
+	if *annotateCloud {
+		if cloudRanges, err = LoadCloudRanges(*rangesDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *verbose {
+			fmt.Fprintf(os.Stderr, "Loaded %d provider prefixes from %s\n", cloudRanges.Len(), *rangesDir)
+		}
+	}
 
-		switch mode {
-		case "dns":
-			if err = ValidateIP(input); err != nil {
-				failureCount++
-				logger.Log(mode, input, err.Error())
-				if *verbose {
-					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				}
-				continue
-			}
-			err = client.QueryDNS(input, callback)
-
-		case "subs":
-			if err = ValidateDomain(input); err != nil {
-				failureCount++
-				logger.Log(mode, input, err.Error())
-				if *verbose {
-					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				}
-				continue
+	var scope *Scope
+	if *scopeFile != "" || *excludeFile != "" {
+		scope = &Scope{}
+		if *scopeFile != "" {
+			if scope.Include, err = LoadScopeList(*scopeFile); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
 			}
-			err = client.QuerySubdomains(input, callback)
-
-		case "cname":
-			if err = ValidateDomain(input); err != nil {
-				failureCount++
-				logger.Log(mode, input, err.Error())
-				if *verbose {
-					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				}
-				continue
+		}
+		if *excludeFile != "" {
+			if scope.Exclude, err = LoadScopeList(*excludeFile); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
 			}
-			err = client.QueryCNAME(input, callback)
 		}
+	} else if *outOfScopeFile != "" {
+		fmt.Fprintln(os.Stderr, "Error: -out-of-scope requires -scope or -exclude")
+		os.Exit(1)
+	}
 
+	// Load the baseline before -db starts a new run in the same database
+	var baseline *Baseline
+	if *diffFile != "" {
+		baseline, err = LoadBaseline(*diffFile)
 		if err != nil {
-			failureCount++
-			logger.Log(mode, input, err.Error())
-			if *verbose {
-				fmt.Fprintf(os.Stderr, "Error querying %s: %v\n", input, err)
-			}
-			continue
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitDiffTrouble)
+		}
+		baseline.Restrict(scope)
+		if *verbose {
+			fmt.Fprintf(os.Stderr, "Diffing against %d result(s) from %s\n", baseline.Len(), *diffFile)
+		}
+	}
+
+	// Initialize components
+	// Tag text output with the producing mode when several modes run,
+	// which is always the case when recursing
+	out, err := NewResultWriter(*outputFormat, os.Stdout, len(modes) > 1 || *recurse > 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Annotations sit under deduplication and the diff, so their counts only
+	// cover results that are actually written
+	var takeoverOut *TakeoverWriter
+	if *takeover {
+		takeoverOut = NewTakeoverWriter(out, fingerprints)
+		out = takeoverOut
+	}
+
+	var cloudOut *CloudWriter
+	if *annotateCloud {
+		cloudOut = NewCloudWriter(out, cloudRanges)
+		out = cloudOut
+	}
+
+	// Deduplication sits under the diff so that removals are judged on every result
+	var dedupeOut *DedupeWriter
+	if *dedupeBloom > 0 {
+		bloom, err := NewBloomFilter(*dedupeBloom, *dedupeFP)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *verbose {
+			fmt.Fprintf(os.Stderr, "Deduplicating with a %d KiB Bloom filter\n", bloom.Size()/1024)
+		}
+		dedupeOut = NewDedupeWriter(out, bloom)
+		out = dedupeOut
+	} else if *dedupe {
+		dedupeOut = NewDedupeWriter(out, NewExactSet())
+		out = dedupeOut
+	}
+
+	// Only the primary output is diffed; the graph and database see every result
+	var diff *DiffWriter
+	if baseline != nil {
+		diff = NewDiffWriter(out, baseline)
+		out = diff
+	}
+
+	if *graphFile != "" {
+		graph, err := NewGraph(*graphFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
+		out = NewMultiWriter(out, graph)
 	}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+	var store *ResultStore
+	if *dbFile != "" {
+		store, err = OpenResultStore(*dbFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		runID, err := store.StartRun()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *verbose {
+			fmt.Fprintf(os.Stderr, "Recording results in %s as run %d\n", *dbFile, runID)
+		}
+		out = NewMultiWriter(out, store)
+	}
+
+	var rejected ResultWriter
+	if *outOfScopeFile != "" {
+		file, err := os.Create(*outOfScopeFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to create out-of-scope file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		rejected, _ = NewResultWriter(*outputFormat, file, len(modes) > 1 || *recurse > 0)
+	}
+
+	logger, err := NewErrorLogger(errorLogFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize error logger: %v\n", err)
 		os.Exit(1)
 	}
+	defer logger.Close()
+
+	var state *StateJournal
+	if *stateFile != "" {
+		state, err = OpenStateJournal(*stateFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open state file: %v\n", err)
+			os.Exit(1)
+		}
+		defer state.Close()
+	}
+
+	client := ipthc.NewClient(apiURL, *limit, *rateLimit, *verbose)
+	client.HTTPClient = httpClient
+	client.MaxPages = *maxPages
+	client.Retry = ipthc.NewRetryPolicy(*retries, *retryMaxWait)
+	client.Quota = ipthc.NewQuotaTracker(*quotaLow, *quotaPause, *quotaStop, *verbose)
 
-	// Exit with failure code if any queries failed
-	if failureCount > 0 {
+	// Replays never touch the API, so there is nothing to rate limit
+	if *replayDir != "" {
+		client.Limiter = ipthc.NewRateLimiter(0)
+	}
+
+	// Recordings must see every request, and replays must come only from the
+	// recording
+	if !*noCache && *recordDir == "" && *replayDir == "" {
+		client.Cache, err = ipthc.NewResponseCache(*cacheDir, *cacheTTL, *refresh)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to initialize cache: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Expired entries are never served again, so keep the cache from growing across runs
+		removed, err := client.Cache.Prune()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else if *verbose && removed > 0 {
+			fmt.Fprintf(os.Stderr, "Pruned %d expired cache entries\n", removed)
+		}
+	}
+
+	runner := &Runner{
+		Client:   client,
+		Out:      out,
+		Logger:   logger,
+		State:    state,
+		Diff:     diff,
+		Scope:    scope,
+		Rejected: rejected,
+		Modes:    modes,
+		MaxRange: *maxRange,
+		MaxDepth: *recurse,
+		Verbose:  *verbose,
+	}
+	client.Warn = runner.Warn
+
+	// Stop cleanly on Ctrl-C: in-flight queries are cancelled and everything
+	// written so far is flushed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Fan stdin out to the worker pool
+	readErr := runner.Run(ctx, os.Stdin, *concurrency)
+	interrupted := ctx.Err() != nil
+	stop()
+
+	// A partial run must not become the baseline for the next -diff
+	if store != nil && !interrupted {
+		if err := store.Finish(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
 		os.Exit(1)
 	}
+
+	if rejected != nil {
+		if err := rejected.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing out-of-scope results: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if interrupted {
+		fmt.Fprintln(os.Stderr, "Interrupted")
+		os.Exit(exitInterrupted)
+	}
+
+	if readErr != nil {
+		fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", readErr)
+		os.Exit(1)
+	}
+
+	if n := runner.Unclassified(); n > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped %d unclassifiable input line(s) (see %s)\n", n, errorLogFile)
+	}
+
+	if n := runner.Mismatched(); n > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d query(s) returned a different number of results than the API advertised (see %s)\n", n, errorLogFile)
+	}
+
+	if n := runner.Failures(); n > 0 {
+		fmt.Fprintf(os.Stderr, "Failed %d query(s): %s (see %s)\n", n, formatFailures(runner.FailuresByClass()), errorLogFile)
+	}
+
+	if n := runner.Truncated(); n > 0 {
+		fmt.Fprintf(os.Stderr, "Truncated %d query(s) at -max-pages %d (see %s)\n", n, *maxPages, errorLogFile)
+	}
+
+	if takeoverOut != nil {
+		fmt.Fprintf(os.Stderr, "Found %d takeover candidate(s)\n", takeoverOut.Candidates())
+	}
+
+	if *verbose && cloudOut != nil {
+		fmt.Fprintf(os.Stderr, "Attributed %d result(s) to a cloud provider\n", cloudOut.Tagged())
+	}
+
+	if *verbose && dedupeOut != nil {
+		fmt.Fprintf(os.Stderr, "Suppressed %d duplicate result(s)\n", dedupeOut.Suppressed())
+	}
+
+	if *verbose && scope != nil {
+		fmt.Fprintf(os.Stderr, "Filtered %d out-of-scope result(s)\n", runner.OutOfScope())
+	}
+
+	if *verbose && client.Cache != nil {
+		fmt.Fprintln(os.Stderr, client.Cache.Stats())
+	}
+
+	if code := exitCode(runner, diff); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// envOr returns the value of the environment variable key, or def if unset
+func envOr(key, def string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return def
+}
+
+// envBool parses the environment variable key as a boolean, false if unset
+func envBool(key string) (bool, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: want true or false", key, value)
+	}
+	return b, nil
 }
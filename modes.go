@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+// AllModes lists every query mode in the order they are run for an input
+var AllModes = []string{ipthc.ModeDNS, ipthc.ModeSubs, ipthc.ModeCNAME}
+
+// AutoModes returns the modes used by -auto: dns for IPs and subs for domains,
+// plus cname for domains when withCNAME is set
+func AutoModes(withCNAME bool) []string {
+	if withCNAME {
+		return AllModes
+	}
+	return []string{ipthc.ModeDNS, ipthc.ModeSubs}
+}
+
+// InputKind is what a sanitized input line looks like
+type InputKind int
+
+const (
+	KindUnknown InputKind = iota
+	KindIP
+	KindRange
+	KindDomain
+)
+
+// Classify determines whether input is an IP address, an IP range or a domain
+// IPs are checked first since they would also pass domain validation
+func Classify(input string) InputKind {
+	if ipthc.ValidateIP(input) == nil {
+		return KindIP
+	}
+	if IsIPRange(input) {
+		if _, err := ParseIPRange(input); err == nil {
+			return KindRange
+		}
+	}
+	if ipthc.ValidateDomain(input) == nil {
+		return KindDomain
+	}
+	return KindUnknown
+}
+
+// ModeAccepts reports whether a query mode can be run for an input of the given kind
+func ModeAccepts(mode string, kind InputKind) bool {
+	switch mode {
+	case ipthc.ModeDNS:
+		return kind == KindIP || kind == KindRange
+	case ipthc.ModeSubs, ipthc.ModeCNAME:
+		return kind == KindDomain
+	default:
+		return false
+	}
+}
+
+// ParseModes parses a comma-separated list of query modes such as "subs,cname"
+// Duplicates are removed and the result follows the order of AllModes
+func ParseModes(list string) ([]string, error) {
+	selected := make(map[string]bool)
+	for _, m := range strings.Split(list, ",") {
+		m = strings.ToLower(strings.TrimSpace(m))
+		if m == "" {
+			continue
+		}
+		if !slices.Contains(AllModes, m) {
+			return nil, fmt.Errorf("unknown mode %q (valid modes: %s)", m, strings.Join(AllModes, ", "))
+		}
+		selected[m] = true
+	}
+
+	var modes []string
+	for _, m := range AllModes {
+		if selected[m] {
+			modes = append(modes, m)
+		}
+	}
+
+	if len(modes) == 0 {
+		return nil, fmt.Errorf("no modes given")
+	}
+	return modes, nil
+}
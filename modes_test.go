@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected InputKind
+	}{
+		{"1.1.1.1", KindIP},
+		{"2606:4700:4700::1111", KindIP},
+		{"10.0.0.0/24", KindRange},
+		{"1.2.3.4-1.2.3.40", KindRange},
+		{"example.com", KindDomain},
+		{"my-site.example.com", KindDomain},
+		{"localhost", KindUnknown},
+		{"not a domain", KindUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := Classify(tt.input); got != tt.expected {
+				t.Errorf("Classify(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestModeAccepts(t *testing.T) {
+	if !ModeAccepts(ipthc.ModeDNS, KindRange) || !ModeAccepts(ipthc.ModeDNS, KindIP) {
+		t.Error("dns should accept IPs and ranges")
+	}
+	if ModeAccepts(ipthc.ModeDNS, KindDomain) {
+		t.Error("dns should not accept domains")
+	}
+	if !ModeAccepts(ipthc.ModeSubs, KindDomain) || !ModeAccepts(ipthc.ModeCNAME, KindDomain) {
+		t.Error("subs and cname should accept domains")
+	}
+	if ModeAccepts(ipthc.ModeCNAME, KindIP) || ModeAccepts(ipthc.ModeSubs, KindUnknown) {
+		t.Error("domain modes should reject IPs and unknown input")
+	}
+}
+
+func TestParseModes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"subs,cname", []string{ipthc.ModeSubs, ipthc.ModeCNAME}},
+		{"cname, dns", []string{ipthc.ModeDNS, ipthc.ModeCNAME}},
+		{"SUBS,subs", []string{ipthc.ModeSubs}},
+		{"dns,subs,cname", AllModes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseModes(tt.input)
+			if err != nil {
+				t.Fatalf("ParseModes(%q) failed: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParseModes(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", ",", "subs,whois"} {
+		if _, err := ParseModes(invalid); err == nil {
+			t.Errorf("ParseModes(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestAutoModes(t *testing.T) {
+	if got := AutoModes(false); !reflect.DeepEqual(got, []string{ipthc.ModeDNS, ipthc.ModeSubs}) {
+		t.Errorf("AutoModes(false) = %v", got)
+	}
+	if got := AutoModes(true); !reflect.DeepEqual(got, AllModes) {
+		t.Errorf("AutoModes(true) = %v", got)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Output formats
+const (
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+// Result is a single result line along with where it came from
+type Result struct {
+	Input     string `json:"input"`
+	Mode      string `json:"mode"`
+	Result    string `json:"result"`
+	Page      int    `json:"page"`
+	Total     int    `json:"total"`
+	Timestamp int64  `json:"ts"`               // Unix seconds
+	Range     string `json:"range,omitempty"`  // Parent CIDR block or dash range of Input
+	Depth     int    `json:"depth,omitempty"`  // Recursion depth of Input
+	From      string `json:"from,omitempty"`   // Input that Input was derived from
+	Change    string `json:"change,omitempty"` // "added" or "removed" when diffing
+
+	Truncated   *Truncation    `json:"truncated,omitempty"`    // Set on the marker of a query cut off by -max-pages
+	Takeover    *TakeoverMatch `json:"takeover,omitempty"`     // Set when Result may be taken over
+	InputCloud  *CloudInfo     `json:"input_cloud,omitempty"`  // Provider owning Input, if an IP
+	ResultCloud *CloudInfo     `json:"result_cloud,omitempty"` // Provider owning Result, if an IP
+}
+
+// Truncation describes how much of a query was fetched before -max-pages cut it off
+type Truncation struct {
+	Pages   int `json:"pages"`
+	Fetched int `json:"fetched"`
+	Total   int `json:"total"`
+}
+
+// IsMarker reports whether r only marks a truncated query rather than carrying a result
+func (r Result) IsMarker() bool {
+	return r.Truncated != nil
+}
+
+// NewResults wraps a page of data received by an ipthc.PageCallback as Results
+func NewResults(mode, input string, data []string, page, total int) []Result {
+	ts := time.Now().Unix()
+	results := make([]Result, len(data))
+	for i, d := range data {
+		results[i] = Result{
+			Input:     input,
+			Mode:      mode,
+			Result:    d,
+			Page:      page,
+			Total:     total,
+			Timestamp: ts,
+		}
+	}
+	return results
+}
+
+// ResultWriter writes results in a particular output format
+// Implementations are safe for concurrent use
+type ResultWriter interface {
+	Write(r Result) error
+	Close() error
+}
+
+// NewResultWriter creates a result writer for the given format
+// When tagMode is set, text output prefixes each line with the mode that produced it
+func NewResultWriter(format string, w io.Writer, tagMode bool) (ResultWriter, error) {
+	switch format {
+	case FormatText:
+		return &textWriter{out: NewLineWriter(w), tagMode: tagMode}, nil
+	case FormatNDJSON:
+		return &ndjsonWriter{out: NewLineWriter(w)}, nil
+	case FormatJSON:
+		return &jsonWriter{out: NewLineWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+// textWriter prints bare result lines, or "mode<TAB>result" when tagging
+// Diffed results are printed as "+|-<TAB>mode<TAB>input<TAB>result"
+// Takeover candidates get "<TAB>takeover=<id><TAB>confidence=<level>" appended,
+// and cloud attribution "<TAB>cloud=<provider/region/service>" for the input
+// and "<TAB>result_cloud=..." for the result
+// Truncation markers are left to structured output.
+type textWriter struct {
+	out     *LineWriter
+	tagMode bool
+}
+
+func (t *textWriter) Write(r Result) error {
+	if r.IsMarker() {
+		return nil
+	}
+
+	var line string
+	switch {
+	case r.Change == ChangeAdded:
+		line = "+\t" + r.Mode + "\t" + r.Input + "\t" + r.Result
+	case r.Change == ChangeRemoved:
+		line = "-\t" + r.Mode + "\t" + r.Input + "\t" + r.Result
+	case t.tagMode:
+		line = r.Mode + "\t" + r.Result
+	default:
+		line = r.Result
+	}
+	if r.Takeover != nil {
+		line += "\ttakeover=" + r.Takeover.ID + "\tconfidence=" + r.Takeover.Confidence
+	}
+	if r.InputCloud != nil {
+		line += "\tcloud=" + r.InputCloud.String()
+	}
+	if r.ResultCloud != nil {
+		line += "\tresult_cloud=" + r.ResultCloud.String()
+	}
+	return t.out.WriteLine(line)
+}
+
+func (t *textWriter) Close() error {
+	return nil
+}
+
+// ndjsonWriter prints one JSON object per line
+type ndjsonWriter struct {
+	out *LineWriter
+}
+
+func (n *ndjsonWriter) Write(r Result) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return n.out.WriteLine(string(line))
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+// jsonWriter streams a single JSON array, one element per line
+type jsonWriter struct {
+	mu      sync.Mutex
+	out     *LineWriter
+	started bool
+}
+
+func (j *jsonWriter) Write(r Result) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !j.started {
+		j.started = true
+		return j.out.WriteLine("[" + string(line))
+	}
+	return j.out.WriteLine("," + string(line))
+}
+
+func (j *jsonWriter) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !j.started {
+		return j.out.WriteLine("[]")
+	}
+	return j.out.WriteLine("]")
+}
+
+// multiWriter sends every result to several writers
+type multiWriter struct {
+	writers []ResultWriter
+}
+
+// NewMultiWriter creates a result writer that writes to all of writers in order
+func NewMultiWriter(writers ...ResultWriter) ResultWriter {
+	return &multiWriter{writers: writers}
+}
+
+func (m *multiWriter) Write(r Result) error {
+	for _, w := range m.writers {
+		if err := w.Write(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every writer, returning the first error
+func (m *multiWriter) Close() error {
+	var first error
+	for _, w := range m.writers {
+		if err := w.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// LineWriter serializes writes from concurrent workers so that every
+// line reaches the underlying writer in one piece
+type LineWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLineWriter creates a line writer wrapping w
+func NewLineWriter(w io.Writer) *LineWriter {
+	return &LineWriter{w: w}
+}
+
+// WriteLine writes a single line followed by a newline
+func (lw *LineWriter) WriteLine(line string) error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	_, err := io.WriteString(lw.w, line+"\n")
+	return err
+}
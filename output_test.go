@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+func TestNewResults(t *testing.T) {
+	results := NewResults("dns", "1.1.1.1", []string{"one.one.one.one", "a.example.com"}, 2, 1041)
+
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+
+	r := results[1]
+	if r.Input != "1.1.1.1" || r.Mode != "dns" || r.Result != "a.example.com" || r.Page != 2 || r.Total != 1041 {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if r.Timestamp == 0 {
+		t.Error("timestamp should be set")
+	}
+}
+
+func TestResultWriter_Text(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewResultWriter(FormatText, &buf, false)
+	if err != nil {
+		t.Fatalf("NewResultWriter failed: %v", err)
+	}
+
+	for _, r := range NewResults("subs", "example.com", []string{"a.example.com", "b.example.com"}, 1, 2) {
+		w.Write(r)
+	}
+	w.Close()
+
+	if buf.String() != "a.example.com\nb.example.com\n" {
+		t.Errorf("unexpected text output: %q", buf.String())
+	}
+}
+
+func TestResultWriter_TextTagged(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewResultWriter(FormatText, &buf, true)
+
+	w.Write(Result{Mode: ipthc.ModeSubs, Result: "a.example.com"})
+	w.Write(Result{Mode: ipthc.ModeCNAME, Result: "b.example.com"})
+	w.Close()
+
+	if buf.String() != "subs\ta.example.com\ncname\tb.example.com\n" {
+		t.Errorf("unexpected tagged output: %q", buf.String())
+	}
+}
+
+func TestResultWriter_NDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewResultWriter(FormatNDJSON, &buf, false)
+
+	for _, r := range NewResults("dns", "1.1.1.1", []string{"one.one.one.one"}, 1, 1) {
+		w.Write(r)
+	}
+	w.Close()
+
+	var r Result
+	if err := json.Unmarshal([]byte(strings.TrimSpace(buf.String())), &r); err != nil {
+		t.Fatalf("output is not valid JSON: %v (%q)", err, buf.String())
+	}
+	if r.Input != "1.1.1.1" || r.Mode != "dns" || r.Result != "one.one.one.one" {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	for _, key := range []string{`"input"`, `"mode"`, `"result"`, `"page"`, `"total"`, `"ts"`} {
+		if !strings.Contains(buf.String(), key) {
+			t.Errorf("output missing key %s: %s", key, buf.String())
+		}
+	}
+}
+
+func TestResultWriter_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewResultWriter(FormatJSON, &buf, false)
+
+	for _, r := range NewResults("cname", "example.com", []string{"a.com", "b.com", "c.com"}, 1, 3) {
+		w.Write(r)
+	}
+	w.Close()
+
+	var results []Result
+	if err := json.Unmarshal(buf.Bytes(), &results); err != nil {
+		t.Fatalf("output is not a valid JSON array: %v (%q)", err, buf.String())
+	}
+	if len(results) != 3 || results[2].Result != "c.com" {
+		t.Errorf("unexpected results: %+v", results)
+	}
+}
+
+func TestResultWriter_JSONEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewResultWriter(FormatJSON, &buf, false)
+	w.Close()
+
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("empty run should produce [], got %q", buf.String())
+	}
+}
+
+func TestNewResultWriter_UnknownFormat(t *testing.T) {
+	if _, err := NewResultWriter("xml", &bytes.Buffer{}, false); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestLineWriter_ConcurrentLinesStayIntact(t *testing.T) {
+	var buf bytes.Buffer
+	out := NewLineWriter(&buf)
+
+	line := strings.Repeat("x", 512)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				out.WriteLine(line)
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 16*50 {
+		t.Fatalf("expected %d lines, got %d", 16*50, len(lines))
+	}
+	for i, l := range lines {
+		if l != line {
+			t.Fatalf("line %d was interleaved: %q", i, l)
+		}
+	}
+}
+
+func TestMultiWriter(t *testing.T) {
+	var a, b bytes.Buffer
+	wa, _ := NewResultWriter(FormatText, &a, false)
+	wb, _ := NewResultWriter(FormatJSON, &b, false)
+
+	w := NewMultiWriter(wa, wb)
+	w.Write(Result{Mode: ipthc.ModeSubs, Result: "a.example.com"})
+	w.Close()
+
+	if a.String() != "a.example.com\n" {
+		t.Errorf("first writer got %q", a.String())
+	}
+	if !strings.HasSuffix(b.String(), "]\n") {
+		t.Errorf("second writer was not closed: %q", b.String())
+	}
+}
+
+func TestResultWriter_TruncationMarker(t *testing.T) {
+	marker := Result{
+		Input:     "example.com",
+		Mode:      ipthc.ModeSubs,
+		Total:     900,
+		Truncated: &Truncation{Pages: 1, Fetched: 100, Total: 900},
+	}
+
+	var text bytes.Buffer
+	w, _ := NewResultWriter(FormatText, &text, true)
+	w.Write(Result{Mode: ipthc.ModeSubs, Result: "a.example.com"})
+	w.Write(marker)
+	w.Close()
+
+	if text.String() != "subs\ta.example.com\n" {
+		t.Errorf("text output should leave out truncation markers: %q", text.String())
+	}
+
+	var ndjson bytes.Buffer
+	w, _ = NewResultWriter(FormatNDJSON, &ndjson, false)
+	w.Write(marker)
+	w.Close()
+
+	var got Result
+	if err := json.Unmarshal(ndjson.Bytes(), &got); err != nil {
+		t.Fatalf("invalid NDJSON: %v", err)
+	}
+	if !got.IsMarker() || *got.Truncated != *marker.Truncated || got.Input != "example.com" {
+		t.Errorf("unexpected marker: %s", ndjson.String())
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+// ApexDomain returns the registrable domain of a hostname, e.g.
+// www.example.co.uk -> example.co.uk
+func ApexDomain(host string) (string, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return publicsuffix.EffectiveTLDPlusOne(host)
+}
+
+// Pivot derives follow-up queries from a single result of a query in mode:
+//   - an IP result is looked up with dns
+//   - a hostname's apex domain is enumerated with subs
+//   - a cname result is itself looked up with cname, following the chain
+func Pivot(mode, result string) []Job {
+	result = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(result), "."))
+
+	switch Classify(result) {
+	case KindIP:
+		return []Job{{Input: result, Mode: ipthc.ModeDNS}}
+
+	case KindDomain:
+		var jobs []Job
+		if apex, err := ApexDomain(result); err == nil {
+			jobs = append(jobs, Job{Input: apex, Mode: ipthc.ModeSubs})
+		}
+		if mode == ipthc.ModeCNAME {
+			jobs = append(jobs, Job{Input: result, Mode: ipthc.ModeCNAME})
+		}
+		return jobs
+	}
+
+	return nil
+}
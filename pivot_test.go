@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+func TestApexDomain(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"www.example.com", "example.com"},
+		{"example.com", "example.com"},
+		{"a.b.c.example.co.uk", "example.co.uk"},
+		{"WWW.Example.COM.", "example.com"},
+		{"foo.s3.amazonaws.com", "foo.s3.amazonaws.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ApexDomain(tt.input)
+			if err != nil {
+				t.Fatalf("ApexDomain(%q) failed: %v", tt.input, err)
+			}
+			if got != tt.expected {
+				t.Errorf("ApexDomain(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPivot(t *testing.T) {
+	tests := []struct {
+		mode     string
+		result   string
+		expected []Job
+	}{
+		{ipthc.ModeDNS, "mail.example.com", []Job{{Input: "example.com", Mode: ipthc.ModeSubs}}},
+		{ipthc.ModeSubs, "dev.api.example.org", []Job{{Input: "example.org", Mode: ipthc.ModeSubs}}},
+		{ipthc.ModeCNAME, "shop.example.net", []Job{
+			{Input: "example.net", Mode: ipthc.ModeSubs},
+			{Input: "shop.example.net", Mode: ipthc.ModeCNAME},
+		}},
+		{ipthc.ModeSubs, "10.1.2.3", []Job{{Input: "10.1.2.3", Mode: ipthc.ModeDNS}}},
+		{ipthc.ModeDNS, "not a result", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.result, func(t *testing.T) {
+			got := Pivot(tt.mode, tt.result)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Pivot(%q, %q) = %+v, want %+v", tt.mode, tt.result, got, tt.expected)
+			}
+		})
+	}
+}
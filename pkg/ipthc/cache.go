@@ -0,0 +1,155 @@
+package ipthc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const DefaultCacheTTL = 24 * time.Hour
+
+// ResponseCache stores raw API responses on disk, keyed by request URL
+// (including ?l= and next-page URLs). An entry's age is its file modification time.
+type ResponseCache struct {
+	Dir     string
+	TTL     time.Duration
+	Refresh bool // Ignore existing entries but still store fresh responses
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// NewResponseCache creates a cache in dir, creating the directory if needed
+func NewResponseCache(dir string, ttl time.Duration, refresh bool) (*ResponseCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &ResponseCache{Dir: dir, TTL: ttl, Refresh: refresh}, nil
+}
+
+// DefaultCacheDir returns the per-user cache directory for ipthc
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "ipthc")
+}
+
+// path returns the file holding the cached response for url
+func (c *ResponseCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+}
+
+// Get returns the cached body for url if present and younger than TTL
+// An expired entry is deleted.
+func (c *ResponseCache) Get(url string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	if c.Refresh {
+		c.misses.Add(1)
+		return "", false
+	}
+
+	path := c.path(url)
+	info, err := os.Stat(path)
+	if err != nil {
+		c.misses.Add(1)
+		return "", false
+	}
+	if time.Since(info.ModTime()) > c.TTL {
+		os.Remove(path)
+		c.misses.Add(1)
+		return "", false
+	}
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		c.misses.Add(1)
+		return "", false
+	}
+
+	c.hits.Add(1)
+	return string(body), true
+}
+
+// Put stores body as the response for url
+// The entry is written to a temp file and renamed so readers never see partial data
+func (c *ResponseCache) Put(url, body string) error {
+	if c == nil {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(c.Dir, "tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	if _, err := tmp.WriteString(body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), c.path(url)); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	return nil
+}
+
+// Prune deletes every entry older than TTL, along with temp files left behind
+// by an interrupted Put, and returns how many files it removed.
+// Other files in Dir are left alone.
+func (c *ResponseCache) Prune() (int, error) {
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || (!isCacheKey(name) && !strings.HasPrefix(name, "tmp-")) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) <= c.TTL {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.Dir, name)); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// isCacheKey reports whether name looks like a file written by Put
+func isCacheKey(name string) bool {
+	if len(name) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// Stats returns a one-line summary of cache usage
+func (c *ResponseCache) Stats() string {
+	hits, misses := c.hits.Load(), c.misses.Load()
+	rate := 0.0
+	if total := hits + misses; total > 0 {
+		rate = float64(hits) / float64(total) * 100
+	}
+	return fmt.Sprintf("Cache: %d hits, %d misses (%.1f%% hit rate)", hits, misses, rate)
+}
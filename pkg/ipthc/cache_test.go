@@ -0,0 +1,169 @@
+package ipthc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseCache_PutGet(t *testing.T) {
+	cache, err := NewResponseCache(t.TempDir(), time.Hour, false)
+	if err != nil {
+		t.Fatalf("NewResponseCache failed: %v", err)
+	}
+
+	if _, ok := cache.Get("https://ip.thc.org/sb/example.com"); ok {
+		t.Error("empty cache should miss")
+	}
+
+	cache.Put("https://ip.thc.org/sb/example.com", "sub.example.com")
+
+	body, ok := cache.Get("https://ip.thc.org/sb/example.com")
+	if !ok || body != "sub.example.com" {
+		t.Errorf("Get = %q, %v; want cached body", body, ok)
+	}
+
+	// Different query strings are different entries
+	if _, ok := cache.Get("https://ip.thc.org/sb/example.com?l=10"); ok {
+		t.Error("URL with ?l= should not share an entry")
+	}
+
+	if !strings.Contains(cache.Stats(), "1 hits, 2 misses") {
+		t.Errorf("unexpected stats: %s", cache.Stats())
+	}
+}
+
+func TestResponseCache_Expired(t *testing.T) {
+	cache, _ := NewResponseCache(t.TempDir(), time.Hour, false)
+	url := "https://ip.thc.org/1.1.1.1"
+	cache.Put(url, "old")
+
+	past := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(cache.path(url), past, past)
+
+	if _, ok := cache.Get(url); ok {
+		t.Error("entry older than TTL should miss")
+	}
+	if _, err := os.Stat(cache.path(url)); !os.IsNotExist(err) {
+		t.Error("expired entry should be deleted when read")
+	}
+}
+
+func TestResponseCache_Prune(t *testing.T) {
+	dir := t.TempDir()
+	cache, _ := NewResponseCache(dir, time.Hour, false)
+	past := time.Now().Add(-2 * time.Hour)
+
+	cache.Put("https://ip.thc.org/1.1.1.1", "old")
+	os.Chtimes(cache.path("https://ip.thc.org/1.1.1.1"), past, past)
+	cache.Put("https://ip.thc.org/1.1.1.2", "fresh")
+
+	leftover := filepath.Join(dir, "tmp-123")
+	os.WriteFile(leftover, []byte("partial"), 0644)
+	os.Chtimes(leftover, past, past)
+	unrelated := filepath.Join(dir, "notes.txt")
+	os.WriteFile(unrelated, nil, 0644)
+	os.Chtimes(unrelated, past, past)
+
+	removed, err := cache.Prune()
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Prune removed %d files, want 2", removed)
+	}
+	if _, ok := cache.Get("https://ip.thc.org/1.1.1.2"); !ok {
+		t.Error("fresh entry should survive pruning")
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Error("files not written by the cache should be left alone")
+	}
+}
+
+func TestResponseCache_Refresh(t *testing.T) {
+	dir := t.TempDir()
+	url := "https://ip.thc.org/1.1.1.1"
+
+	cache, _ := NewResponseCache(dir, time.Hour, false)
+	cache.Put(url, "old")
+
+	refreshing, _ := NewResponseCache(dir, time.Hour, true)
+	if _, ok := refreshing.Get(url); ok {
+		t.Error("refresh mode should ignore cached entries")
+	}
+	refreshing.Put(url, "new")
+
+	if body, _ := cache.Get(url); body != "new" {
+		t.Errorf("refresh should overwrite entry, got %q", body)
+	}
+}
+
+func TestClient_CacheHitSkipsNetworkAndRateLimit(t *testing.T) {
+	requestCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.Write([]byte(";;Entries: 1/1\n;;Rate Limit: You can make 5 requests\none.one.one.one"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 0, 0.2, false)
+	client.Cache, _ = NewResponseCache(t.TempDir(), time.Hour, false)
+	client.Quota = NewQuotaTracker(0, time.Second, false, false)
+
+	var first []string
+	if err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(&first)); err != nil {
+		t.Fatalf("QueryDNS failed: %v", err)
+	}
+
+	// Pretend the quota moved on; a cached page must not roll it back
+	client.Quota.Update(3)
+
+	start := time.Now()
+	var second []string
+	if err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(&second)); err != nil {
+		t.Fatalf("cached QueryDNS failed: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if requestCount != 1 {
+		t.Errorf("expected 1 network request, got %d", requestCount)
+	}
+	if len(second) != 1 || second[0] != "one.one.one.one" {
+		t.Errorf("cached results = %v", second)
+	}
+	if elapsed >= 200*time.Millisecond {
+		t.Errorf("cache hit should not wait on the rate limiter, took %v", elapsed)
+	}
+	if got := client.Quota.Remaining(); got != 3 {
+		t.Errorf("cache hit changed quota to %d", got)
+	}
+}
+
+func TestClient_ErrorsAreNotCached(t *testing.T) {
+	requestCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		if requestCount == 1 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(";;Entries: 1/1\nok"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 0, 0, false)
+	client.Cache, _ = NewResponseCache(t.TempDir(), time.Hour, false)
+
+	client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(new([]string)))
+	if err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(new([]string))); err != nil {
+		t.Errorf("second query should reach the server, got %v", err)
+	}
+	if requestCount != 2 {
+		t.Errorf("expected 2 requests, got %d", requestCount)
+	}
+}
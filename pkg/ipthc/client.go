@@ -0,0 +1,384 @@
+// Package ipthc is a client for the ip.thc.org reverse DNS, subdomain and
+// CNAME lookup API. It handles pagination, rate limiting, retries, quota
+// throttling and response caching, and honours context cancellation and
+// deadlines throughout.
+package ipthc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Client handles API requests to ip.thc.org
+// A Client is safe for concurrent use by multiple goroutines. Create one with
+// NewClient: the zero value has no HTTPClient and must not be used. Set any
+// fields before the first query; changing them while queries run is a data race.
+type Client struct {
+	BaseURL    string
+	Limit      int
+	HTTPClient *http.Client
+	Verbose    bool
+	Limiter    *RateLimiter   // Shared by all goroutines using this client
+	Retry      RetryPolicy    // NewClient sets DefaultRetries and DefaultRetryMaxWait
+	Quota      *QuotaTracker  // nil disables quota-aware throttling
+	Cache      *ResponseCache // nil disables response caching
+	MaxPages   int            // Pages fetched per query before it is truncated (0 for unlimited)
+	Warn       WarnFunc       // Receives problems that did not fail a query (nil prints them in verbose mode)
+}
+
+// DefaultMaxPages caps pagination so a runaway query cannot fetch forever
+const DefaultMaxPages = 100
+
+// ErrTruncated is matched by errors.Is for a *TruncatedError
+var ErrTruncated = errors.New("results truncated")
+
+// TruncatedError is returned when a query stops at MaxPages with pages left
+// Every page up to the cap has already been delivered to the callback.
+type TruncatedError struct {
+	Pages   int // Pages fetched
+	Fetched int // Results fetched
+	Total   int // Results advertised by the API
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("truncated at %d pages: fetched %d of %d results", e.Pages, e.Fetched, e.Total)
+}
+
+func (e *TruncatedError) Unwrap() error { return ErrTruncated }
+
+// NewClient creates a new API client
+// limit caps the results of each query (0 fetches every page) and rateLimit
+// is the minimum delay in seconds between requests (0 disables it)
+func NewClient(baseURL string, limit int, rateLimit float64, verbose bool) *Client {
+	return &Client{
+		BaseURL: baseURL,
+		Limit:   limit,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		Verbose:  verbose,
+		Limiter:  NewRateLimiter(rateLimit),
+		Retry:    NewRetryPolicy(DefaultRetries, DefaultRetryMaxWait),
+		MaxPages: DefaultMaxPages,
+	}
+}
+
+// Query modes
+const (
+	ModeDNS   = "dns"
+	ModeSubs  = "subs"
+	ModeCNAME = "cname"
+)
+
+// PageCallback is called for each page of results
+type PageCallback func(results []string, currentPage int, totalResults int) error
+
+// Checkpoint is the pagination position of a query after a page was delivered
+type Checkpoint struct {
+	Page        int    `json:"page"`              // Last page passed to the callback
+	Total       int    `json:"total"`             // Total results advertised by the API
+	Fetched     int    `json:"fetched,omitempty"` // Results passed to the callback so far
+	NextPageURL string `json:"next,omitempty"`    // Where to continue from ("" when finished)
+}
+
+// CheckpointFunc is called after each page has been handled by the PageCallback
+type CheckpointFunc func(cp Checkpoint) error
+
+// QueryDNS returns the hostnames of an IP address, fetching every page
+func (c *Client) QueryDNS(ctx context.Context, ip string) ([]string, error) {
+	return c.collect(ctx, ModeDNS, ip)
+}
+
+// QuerySubdomains returns the subdomains of a domain, fetching every page
+func (c *Client) QuerySubdomains(ctx context.Context, domain string) ([]string, error) {
+	return c.collect(ctx, ModeSubs, domain)
+}
+
+// QueryCNAME returns the domains with a CNAME pointing at domain, fetching every page
+func (c *Client) QueryCNAME(ctx context.Context, domain string) ([]string, error) {
+	return c.collect(ctx, ModeCNAME, domain)
+}
+
+// collect gathers every page of a query; on error the results fetched so far
+// are returned along with it
+func (c *Client) collect(ctx context.Context, mode, input string) ([]string, error) {
+	var all []string
+	err := c.Query(ctx, mode, input, func(results []string, _, _ int) error {
+		all = append(all, results...)
+		return nil
+	})
+	return all, err
+}
+
+// Query performs a lookup for input in the given mode, streaming each page to callback
+func (c *Client) Query(ctx context.Context, mode, input string, callback PageCallback) error {
+	return c.QueryFrom(ctx, mode, input, nil, callback, nil)
+}
+
+// QueryFrom performs a lookup like Query, resuming pagination from a
+// previous checkpoint if from is non-nil, and reporting progress to
+// checkpoint (if non-nil) after every page
+func (c *Client) QueryFrom(ctx context.Context, mode, input string, from *Checkpoint, callback PageCallback, checkpoint CheckpointFunc) error {
+	endpoint, err := Endpoint(mode, input)
+	if err != nil {
+		return err
+	}
+	if checkpoint == nil {
+		checkpoint = func(Checkpoint) error { return nil }
+	}
+	return c.queryWithCallback(ctx, mode, input, endpoint, from, callback, checkpoint)
+}
+
+// Endpoint returns the API path for a lookup in the given mode
+// The input is validated first, so it can never alter the URL
+func Endpoint(mode, input string) (string, error) {
+	if err := ValidateInput(mode, input); err != nil {
+		return "", err
+	}
+	switch mode {
+	case ModeDNS:
+		return fmt.Sprintf("/%s", input), nil
+	case ModeSubs:
+		return fmt.Sprintf("/sb/%s", input), nil
+	case ModeCNAME:
+		return fmt.Sprintf("/cn/%s", input), nil
+	default:
+		return "", &InputError{Input: mode, Reason: fmt.Sprintf("unknown mode: %s", mode)}
+	}
+}
+
+// queryWithCallback handles automatic pagination with streaming via callback
+func (c *Client) queryWithCallback(ctx context.Context, mode, input, endpoint string, from *Checkpoint, callback PageCallback, checkpoint CheckpointFunc) error {
+	parser := NewResponseParser(c.Verbose)
+	guard := newPageGuard(c.BaseURL)
+
+	var nextURL string
+	var pageCount, totalCount, fetched int
+
+	// Checkpoints written before fetched counts were recorded cannot be reconciled
+	counted := from == nil || from.NextPageURL == "" || from.Fetched > 0 || from.Page == 0
+
+	if from != nil && from.NextPageURL != "" {
+		// Pick up where a previous run left off
+		nextURL = from.NextPageURL
+		pageCount = from.Page
+		totalCount = from.Total
+		fetched = from.Fetched
+		if c.Verbose {
+			fmt.Fprintf(os.Stderr, "Resuming at page %d...\n", pageCount+1)
+		}
+	} else {
+		// Make initial request
+		url := fmt.Sprintf("%s%s", c.BaseURL, endpoint)
+		if c.Limit > 0 {
+			url = fmt.Sprintf("%s?l=%d", url, c.Limit)
+		}
+
+		guard.seen[url] = 1
+		body, err := c.makeRequest(ctx, url)
+		if err != nil {
+			return err
+		}
+
+		// Parse first page
+		result := parser.Parse(body)
+		c.warnPage(1, result, result.TotalCount)
+
+		// Call callback with first page
+		if err := callback(result.Data, 1, result.TotalCount); err != nil {
+			return err
+		}
+		fetched = len(result.Data)
+
+		// If user specified a limit, respect it and don't auto-paginate
+		// If there's no next page, we're done
+		if c.Limit > 0 || !result.HasMore() {
+			if err := checkpoint(Checkpoint{Page: 1, Total: result.TotalCount, Fetched: fetched}); err != nil {
+				return err
+			}
+			if c.Limit == 0 {
+				c.reconcile(mode, input, fetched, result.TotalCount)
+			}
+			return nil
+		}
+
+		nextURL = result.NextPageURL
+		pageCount = 1
+		totalCount = result.TotalCount
+
+		if err := checkpoint(Checkpoint{Page: 1, Total: totalCount, Fetched: fetched, NextPageURL: nextURL}); err != nil {
+			return err
+		}
+
+		// Auto-pagination: follow next page links
+		if c.Verbose {
+			fmt.Fprintf(os.Stderr, "Auto-pagination: fetching all %d results...\n", totalCount)
+		}
+	}
+
+	for nextURL != "" {
+		// Stop at the page cap, saying how much was left behind
+		if c.MaxPages > 0 && pageCount >= c.MaxPages {
+			if c.Verbose {
+				fmt.Fprintf(os.Stderr, "Reached maximum page limit (%d)\n", c.MaxPages)
+			}
+			return &TruncatedError{Pages: pageCount, Fetched: fetched, Total: totalCount}
+		}
+
+		pageCount++
+		if err := guard.check(nextURL, pageCount); err != nil {
+			return err
+		}
+		if c.Verbose {
+			fmt.Fprintf(os.Stderr, "Fetching page %d...\n", pageCount)
+		}
+
+		pageBody, err := c.makeRequest(ctx, nextURL)
+		if err != nil {
+			// Return error if pagination fails
+			if c.Verbose {
+				fmt.Fprintf(os.Stderr, "Pagination failed: %v\n", err)
+			}
+			return fmt.Errorf("page %d: %w", pageCount, err)
+		}
+
+		pageResult := parser.Parse(pageBody)
+		c.warnPage(pageCount, pageResult, totalCount)
+
+		// Call callback with this page's data
+		if err := callback(pageResult.Data, pageCount, totalCount); err != nil {
+			return err
+		}
+		fetched += len(pageResult.Data)
+
+		nextURL = pageResult.NextPageURL
+
+		if err := checkpoint(Checkpoint{Page: pageCount, Total: totalCount, Fetched: fetched, NextPageURL: nextURL}); err != nil {
+			return err
+		}
+	}
+
+	if counted {
+		c.reconcile(mode, input, fetched, totalCount)
+	}
+	return nil
+}
+
+// warnPage reports, in verbose mode, a page whose entry counts disagree with
+// its contents or with the total advertised by the first page
+func (c *Client) warnPage(page int, result *ParseResult, total int) {
+	if !c.Verbose {
+		return
+	}
+	if result.CurrentCount != len(result.Data) && (result.CurrentCount != 0 || result.TotalCount != 0) {
+		fmt.Fprintf(os.Stderr, "Warning: page %d advertised %d entries but contained %d\n", page, result.CurrentCount, len(result.Data))
+	}
+	if result.TotalCount != 0 && result.TotalCount != total {
+		fmt.Fprintf(os.Stderr, "Warning: page %d advertised %d total results, the first page %d\n", page, result.TotalCount, total)
+	}
+}
+
+// makeRequest performs the HTTP request with caching, rate limiting and retries
+// Safe for concurrent use: all callers share the client's Limiter
+// Cache hits are served without touching the rate limiter or quota.
+// Transient failures are retried per c.Retry; each attempt only re-fetches this
+// URL, so a failed page is resumed rather than restarting the whole query.
+func (c *Client) makeRequest(ctx context.Context, url string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if body, ok := c.Cache.Get(url); ok {
+		if c.Verbose {
+			fmt.Fprintf(os.Stderr, "Cache hit: %s\n", url)
+		}
+		return body, nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		body, err := c.doRequest(ctx, url)
+		if err == nil {
+			if err := c.Cache.Put(url, body); err != nil && c.Verbose {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+			return body, nil
+		}
+
+		if ctx.Err() != nil || attempt >= c.Retry.MaxRetries || !isRetryable(err) {
+			if attempt > 0 {
+				return "", fmt.Errorf("%w (after %d retries)", err, attempt)
+			}
+			return "", err
+		}
+
+		wait := c.Retry.Backoff(attempt, err)
+		if c.Verbose {
+			fmt.Fprintf(os.Stderr, "Request failed (%v), retrying in %v (%d/%d)...\n",
+				err, wait.Round(time.Millisecond), attempt+1, c.Retry.MaxRetries)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return "", err
+		}
+	}
+}
+
+// doRequest performs a single rate-limited HTTP GET
+func (c *Client) doRequest(ctx context.Context, url string) (string, error) {
+	// Slow down or pause if the API quota is running out
+	if err := c.Quota.Wait(ctx); err != nil {
+		return "", err
+	}
+
+	// Apply rate limiting
+	if err := c.Limiter.Wait(ctx); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid request URL: %w", err)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		// Cancellation, gaps in a replayed recording and bad certificates are not worth retrying
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if errors.Is(err, ErrNotRecorded) {
+			return "", fmt.Errorf("HTTP request failed: %w", err)
+		}
+		if isCertificateError(err) {
+			return "", &certificateError{fmt.Errorf("HTTP request failed: %w", err)}
+		}
+		return "", &transientError{fmt.Errorf("HTTP request failed: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", &transientError{fmt.Errorf("failed to read response: %w", err)}
+	}
+
+	// Only live responses carry a current quota, so track it here rather than
+	// after the cache
+	c.Quota.Update(ParseRemaining(string(body)))
+
+	return string(body), nil
+}
@@ -0,0 +1,385 @@
+package ipthc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DFC302/ipthc/pkg/ipthc/ipthctest"
+)
+
+// collect returns a PageCallback that gathers every result into a slice
+func collect(results *[]string) PageCallback {
+	return func(data []string, currentPage int, totalResults int) error {
+		*results = append(*results, data...)
+		return nil
+	}
+}
+
+func TestClient_QueryDNS(t *testing.T) {
+	// Mock server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/1.1.1.1") {
+			t.Errorf("expected path to contain IP, got %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(";;Entries: 2/2\n;;DNS Response\ndomain1.com\ndomain2.com"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 200, 0, false)
+	results, err := client.QueryDNS(context.Background(), "1.1.1.1")
+	body := strings.Join(results, "\n")
+
+	if err != nil {
+		t.Fatalf("QueryDNS failed: %v", err)
+	}
+
+	if !strings.Contains(body, "domain1.com") {
+		t.Errorf("expected response to contain domain1.com")
+	}
+}
+
+func TestClient_QuerySubdomains(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/sb/example.com") {
+			t.Errorf("expected path /sb/example.com, got %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(";;Entries: 2/2\n;;Subdomains\nsub1.example.com\nsub2.example.com"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 200, 0, false)
+	results, err := client.QuerySubdomains(context.Background(), "example.com")
+	body := strings.Join(results, "\n")
+
+	if err != nil {
+		t.Fatalf("QuerySubdomains failed: %v", err)
+	}
+
+	if !strings.Contains(body, "sub1.example.com") {
+		t.Errorf("expected response to contain sub1.example.com")
+	}
+}
+
+func TestClient_QueryCNAME(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/cn/example.com") {
+			t.Errorf("expected path /cn/example.com, got %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(";;Entries: 2/2\n;;CNAME Response\ncname1.com\ncname2.com"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 200, 0, false)
+	results, err := client.QueryCNAME(context.Background(), "example.com")
+	body := strings.Join(results, "\n")
+
+	if err != nil {
+		t.Fatalf("QueryCNAME failed: %v", err)
+	}
+
+	if !strings.Contains(body, "cname1.com") {
+		t.Errorf("expected response to contain cname1.com")
+	}
+}
+
+func TestClient_Pagination(t *testing.T) {
+	requestCount := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		page := r.URL.Query().Get("page")
+
+		if requestCount == 1 {
+			// First request: return partial results with a next page link
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(";;Entries: 2/10\n;;Next Page: " + server.URL + "/sb/example.com?page=2\nsub1.example.com\nsub2.example.com"))
+		} else if requestCount == 2 {
+			// Second request: should follow the next page link
+			if page != "2" {
+				t.Errorf("second request should have page=2, got page=%s", page)
+			}
+			// Return remaining results
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(";;Entries: 8/10\nsub3.example.com\nsub4.example.com\nsub5.example.com\nsub6.example.com\nsub7.example.com\nsub8.example.com\nsub9.example.com\nsub10.example.com"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 0, 0, false)
+	results, err := client.QuerySubdomains(context.Background(), "example.com")
+	body := strings.Join(results, "\n")
+
+	if err != nil {
+		t.Fatalf("QuerySubdomains with pagination failed: %v", err)
+	}
+
+	// Should have made 2 requests
+	if requestCount != 2 {
+		t.Errorf("expected 2 requests (initial + pagination), got %d", requestCount)
+	}
+
+	// Should have all 10 results
+	if !strings.Contains(body, "sub10.example.com") {
+		t.Errorf("expected response to contain all results including sub10.example.com")
+	}
+}
+
+func TestClient_NoPagination(t *testing.T) {
+	requestCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.WriteHeader(http.StatusOK)
+		// All results in first response
+		w.Write([]byte(";;Entries: 5/5\nsub1.example.com\nsub2.example.com\nsub3.example.com\nsub4.example.com\nsub5.example.com"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 200, 0, false)
+	results, err := client.QuerySubdomains(context.Background(), "example.com")
+	body := strings.Join(results, "\n")
+
+	if err != nil {
+		t.Fatalf("QuerySubdomains failed: %v", err)
+	}
+
+	// Should only make 1 request since we got everything
+	if requestCount != 1 {
+		t.Errorf("expected 1 request (no pagination needed), got %d", requestCount)
+	}
+
+	if !strings.Contains(body, "sub5.example.com") {
+		t.Errorf("expected response to contain all 5 results")
+	}
+}
+
+func TestClient_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Server Error"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 200, 0, false)
+	client.Retry = fastRetry
+	err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(new([]string)))
+
+	if err == nil {
+		t.Errorf("expected error for 500 status, got nil")
+	}
+
+	if !strings.Contains(err.Error(), "500") {
+		t.Errorf("error should mention status code 500: %v", err)
+	}
+}
+
+func TestClient_RateLimit(t *testing.T) {
+	requestCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(";;Entries: 1/1\nok"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 200, 0.1, false)
+
+	start := time.Now()
+	client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(new([]string)))
+	client.Query(context.Background(), ModeDNS, "1.1.1.2", collect(new([]string)))
+	elapsed := time.Since(start)
+
+	// Should take at least 100ms due to rate limit
+	if elapsed < 100*time.Millisecond {
+		t.Errorf("rate limiting not working: took %v, expected >= 100ms", elapsed)
+	}
+
+	if requestCount != 2 {
+		t.Errorf("expected 2 requests, got %d", requestCount)
+	}
+}
+
+func TestClient_PaginationRateLimit(t *testing.T) {
+	requestCount := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		if requestCount == 1 {
+			w.Write([]byte(";;Entries: 2/10\n;;Next Page: " + server.URL + "/sb/example.com?page=2\nsub1\nsub2"))
+		} else {
+			w.Write([]byte(";;Entries: 8/10\nsub3\nsub4\nsub5\nsub6\nsub7\nsub8\nsub9\nsub10"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 0, 0.1, false)
+
+	start := time.Now()
+	client.Query(context.Background(), ModeSubs, "example.com", collect(new([]string)))
+	elapsed := time.Since(start)
+
+	// Should wait between pagination requests
+	if elapsed < 100*time.Millisecond {
+		t.Errorf("pagination should respect rate limit: took %v, expected >= 100ms", elapsed)
+	}
+
+	if requestCount != 2 {
+		t.Errorf("expected 2 requests, got %d", requestCount)
+	}
+}
+
+func TestClient_CancelStopsPagination(t *testing.T) {
+	requestCount := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.Write([]byte(fmt.Sprintf(";;Entries: 1/10\n;;Next Page: %s/sb/example.com?page=%d\nsub%d", server.URL, requestCount+1, requestCount)))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := NewClient(server.URL, 0, 0, false)
+	err := client.Query(ctx, ModeSubs, "example.com", func(results []string, page, total int) error {
+		if page == 2 {
+			cancel()
+		}
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if requestCount != 2 {
+		t.Errorf("expected pagination to stop after 2 requests, got %d", requestCount)
+	}
+}
+
+func TestClient_DeadlineInterruptsRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(";;Entries: 1/1\nok"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 0, 10, false)
+	if err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(new([]string))); err != nil {
+		t.Fatalf("first query failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := client.Query(ctx, ModeDNS, "1.1.1.2", collect(new([]string)))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("deadline should interrupt the 10s rate limit wait, took %v", elapsed)
+	}
+}
+
+func TestClient_CancelSkipsRetryBackoff(t *testing.T) {
+	requestCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 0, 0, false)
+	client.Retry = NewRetryPolicy(5, 10*time.Second)
+	client.Retry.BaseWait = 10 * time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := client.Query(ctx, ModeDNS, "1.1.1.1", collect(new([]string)))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("deadline should interrupt retry backoff, took %v", elapsed)
+	}
+	if requestCount != 1 {
+		t.Errorf("expected 1 request before the deadline, got %d", requestCount)
+	}
+}
+
+func TestClient_MaxPagesTruncates(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	var subs []string
+	for i := 1; i <= 10; i++ {
+		subs = append(subs, fmt.Sprintf("sub%d.example.com", i))
+	}
+	server.AddSubdomains("example.com", subs...)
+	server.SetPageSize(2)
+
+	client := NewClient(server.URL, 0, 0, false)
+	client.MaxPages = 2
+
+	var last Checkpoint
+	var results []string
+	err := client.QueryFrom(context.Background(), ModeSubs, "example.com", nil, collect(&results), func(cp Checkpoint) error {
+		last = cp
+		return nil
+	})
+
+	var te *TruncatedError
+	if !errors.As(err, &te) || !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected a TruncatedError, got %v", err)
+	}
+	if *te != (TruncatedError{Pages: 2, Fetched: 4, Total: 10}) {
+		t.Errorf("unexpected truncation: %+v", *te)
+	}
+	if len(results) != 4 || len(server.Requests()) != 2 {
+		t.Errorf("expected 4 results from 2 requests, got %v from %v", results, server.Requests())
+	}
+
+	// Raising the cap lets a resumed query pick up where the truncated one stopped
+	client.MaxPages = 0
+	err = client.QueryFrom(context.Background(), ModeSubs, "example.com", &last, collect(&results), nil)
+	if err != nil {
+		t.Fatalf("resumed query failed: %v", err)
+	}
+	if !slices.Equal(results, subs) {
+		t.Errorf("expected all 10 results after resuming, got %v", results)
+	}
+}
+
+func TestClient_MaxPagesUnlimited(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	var subs []string
+	for i := 1; i <= 150; i++ {
+		subs = append(subs, fmt.Sprintf("sub%d.example.com", i))
+	}
+	server.AddSubdomains("example.com", subs...)
+	server.SetPageSize(1)
+
+	client := NewClient(server.URL, 0, 0, false)
+	if client.MaxPages != DefaultMaxPages {
+		t.Errorf("expected default cap %d, got %d", DefaultMaxPages, client.MaxPages)
+	}
+	client.MaxPages = 0
+
+	results, err := client.QuerySubdomains(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("QuerySubdomains failed: %v", err)
+	}
+	if len(results) != 150 {
+		t.Errorf("expected all 150 pages without a cap, got %d results", len(results))
+	}
+}
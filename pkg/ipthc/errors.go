@@ -0,0 +1,81 @@
+package ipthc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Failure classes, matched with errors.Is against any error returned by a
+// Client or the validators
+var (
+	ErrInvalidInput = errors.New("invalid input")          // Rejected before any request was made (see *InputError)
+	ErrNetwork      = errors.New("network error")          // The API could not be reached or the response was cut off
+	ErrHTTPStatus   = errors.New("unexpected HTTP status") // The API answered with a non-200 status (see *StatusError)
+	ErrRateLimited  = errors.New("rate limited")           // HTTP 429, or the quota ran out (ErrQuotaExhausted)
+)
+
+// InputError is returned for an IP, domain or mode that cannot be queried
+type InputError struct {
+	Input  string
+	Reason string
+}
+
+func (e *InputError) Error() string { return e.Reason }
+
+func (e *InputError) Is(target error) bool { return target == ErrInvalidInput }
+
+// StatusError is returned for non-200 responses once retries are used up
+// It matches ErrHTTPStatus, and ErrRateLimited for 429.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration // Parsed Retry-After header, 0 if absent
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Status)
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == ErrHTTPStatus || (target == ErrRateLimited && e.StatusCode == http.StatusTooManyRequests)
+}
+
+// transientError wraps transport failures (timeouts, resets, refused connections)
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+func (e *transientError) Is(target error) bool { return target == ErrNetwork }
+
+// certificateError wraps TLS verification failures, which a retry cannot fix
+type certificateError struct {
+	err error
+}
+
+func (e *certificateError) Error() string { return e.err.Error() }
+func (e *certificateError) Unwrap() error { return e.err }
+
+func (e *certificateError) Is(target error) bool { return target == ErrNetwork }
+
+// isCertificateError reports whether err comes from verifying the server's certificate
+func isCertificateError(err error) bool {
+	var verr *tls.CertificateVerificationError
+	var hostErr x509.HostnameError
+	var authErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &verr) || errors.As(err, &hostErr) || errors.As(err, &authErr) || errors.As(err, &invalidErr)
+}
+
+// quotaError is the type of ErrQuotaExhausted, which also matches ErrRateLimited
+type quotaError struct{}
+
+func (quotaError) Error() string { return "API quota exhausted" }
+
+func (quotaError) Is(target error) bool { return target == ErrRateLimited }
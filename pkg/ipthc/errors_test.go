@@ -0,0 +1,108 @@
+package ipthc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrors_InvalidInput(t *testing.T) {
+	for _, err := range []error{ValidateIP("999.1.1.1"), ValidateDomain("nodot"), ValidateDomain("")} {
+		var ie *InputError
+		if !errors.Is(err, ErrInvalidInput) || !errors.As(err, &ie) {
+			t.Errorf("%v should be an *InputError matching ErrInvalidInput", err)
+		}
+	}
+
+	if _, err := Endpoint("bogus", "example.com"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("unknown mode: got %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestErrors_InvalidInputIsNotSent(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, 0, 0, false)
+
+	tests := []struct {
+		mode, input string
+	}{
+		{ModeDNS, "not-an-ip"},
+		{ModeDNS, "example.com"},
+		{ModeSubs, "example.com/admin"},
+		{ModeSubs, "example.com?page=2"},
+		{ModeCNAME, "example.com#fragment"},
+		{ModeCNAME, ""},
+	}
+	for _, tt := range tests {
+		err := client.Query(context.Background(), tt.mode, tt.input, collect(new([]string)))
+		var ie *InputError
+		if !errors.Is(err, ErrInvalidInput) || !errors.As(err, &ie) {
+			t.Errorf("%s %q: got %v, want an *InputError", tt.mode, tt.input, err)
+		}
+	}
+	if requests != 0 {
+		t.Errorf("invalid inputs made %d request(s), want 0", requests)
+	}
+}
+
+func TestErrors_HTTPStatus(t *testing.T) {
+	tests := []struct {
+		status      int
+		rateLimited bool
+	}{
+		{http.StatusNotFound, false},
+		{http.StatusBadGateway, false},
+		{http.StatusTooManyRequests, true},
+	}
+
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		client := NewClient(server.URL, 0, 0, false)
+		client.Retry = fastRetry
+
+		err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(new([]string)))
+		server.Close()
+
+		var se *StatusError
+		if !errors.Is(err, ErrHTTPStatus) || !errors.As(err, &se) || se.StatusCode != tt.status {
+			t.Errorf("status %d: got %v, want a *StatusError matching ErrHTTPStatus", tt.status, err)
+		}
+		if errors.Is(err, ErrRateLimited) != tt.rateLimited {
+			t.Errorf("status %d: errors.Is(ErrRateLimited) = %v, want %v", tt.status, !tt.rateLimited, tt.rateLimited)
+		}
+		if errors.Is(err, ErrNetwork) {
+			t.Errorf("status %d: should not match ErrNetwork", tt.status)
+		}
+	}
+}
+
+func TestErrors_Network(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	client := NewClient(url, 0, 0, false)
+	client.Retry = fastRetry
+
+	err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(new([]string)))
+	if !errors.Is(err, ErrNetwork) || errors.Is(err, ErrHTTPStatus) {
+		t.Errorf("got %v, want ErrNetwork", err)
+	}
+}
+
+func TestErrors_QuotaExhaustedIsRateLimited(t *testing.T) {
+	if !errors.Is(ErrQuotaExhausted, ErrRateLimited) {
+		t.Error("ErrQuotaExhausted should match ErrRateLimited")
+	}
+	if errors.Is(ErrRateLimited, ErrQuotaExhausted) {
+		t.Error("ErrRateLimited should not match ErrQuotaExhausted")
+	}
+}
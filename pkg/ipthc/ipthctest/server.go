@@ -0,0 +1,254 @@
+// Package ipthctest provides a fake ip.thc.org API server for tests.
+//
+// The server answers the same paths as the real API (/{ip}, /sb/{domain} and
+// /cn/{domain}) with the same plain-text format: ANSI-colored ;; comment lines
+// carrying the entry counts, next page link and remaining quota, followed by
+// one result per line. Results come from seeded datasets, so runs are
+// deterministic, and failures can be injected on demand.
+package ipthctest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPageSize is how many results a page holds unless changed with SetPageSize
+const DefaultPageSize = 100
+
+// ANSI codes the real API wraps its comment lines in
+const (
+	colorComment = "\x1b[0;33m"
+	colorReset   = "\x1b[0m"
+)
+
+// Fault is a failure injected into the next request
+type Fault struct {
+	Status     int           // HTTP status to answer with (0 serves the request normally)
+	RetryAfter time.Duration // Sent as a Retry-After header when non-zero
+	Delay      time.Duration // Wait before answering, cut short if the client gives up
+}
+
+// Server is a fake ip.thc.org API
+// Configuration methods are safe to call while requests are being served.
+type Server struct {
+	URL string // Base URL to point clients at, e.g. http://127.0.0.1:41234
+
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	data     map[string][]string // Results keyed by request path
+	pageSize int
+	quota    int // Requests left, -1 for unlimited
+	delay    time.Duration
+	color    bool
+	faults   []Fault
+	requests []string
+}
+
+// NewServer starts a fake API with no data, unlimited quota and colored output
+// The caller should call Close when finished.
+func NewServer() *Server {
+	s := &Server{
+		data:     make(map[string][]string),
+		pageSize: DefaultPageSize,
+		quota:    -1,
+		color:    true,
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// AddDNS seeds the hostnames returned for a reverse DNS lookup of ip
+func (s *Server) AddDNS(ip string, hosts ...string) {
+	s.add("/"+ip, hosts)
+}
+
+// AddSubdomains seeds the subdomains returned for domain
+func (s *Server) AddSubdomains(domain string, subdomains ...string) {
+	s.add("/sb/"+domain, subdomains)
+}
+
+// AddCNAME seeds the domains returned as having a CNAME pointing at domain
+func (s *Server) AddCNAME(domain string, names ...string) {
+	s.add("/cn/"+domain, names)
+}
+
+func (s *Server) add(path string, results []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[path] = append(s.data[path], results...)
+}
+
+// SetPageSize sets how many results each page holds
+func (s *Server) SetPageSize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageSize = max(n, 1)
+}
+
+// SetQuota limits the server to n more successful requests, each reported in
+// a ;;Rate Limit: line; once it reaches zero requests are answered with 429
+// A negative n removes the limit and the ;;Rate Limit: line.
+func (s *Server) SetQuota(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quota = max(n, -1)
+}
+
+// Quota returns the requests left, or -1 if unlimited
+func (s *Server) Quota() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.quota
+}
+
+// SetDelay slows down every response by d
+func (s *Server) SetDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = d
+}
+
+// SetColor turns the ANSI colors around comment lines on or off
+func (s *Server) SetColor(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.color = on
+}
+
+// Inject queues faults that are applied to the next requests, one each, in order
+func (s *Server) Inject(faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, faults...)
+}
+
+// Requests returns the request URI of every request received so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.URL.RequestURI())
+	var fault Fault
+	if len(s.faults) > 0 {
+		fault = s.faults[0]
+		s.faults = s.faults[1:]
+	}
+	delay := s.delay + fault.Delay
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if fault.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(fault.RetryAfter.Round(time.Second)/time.Second)))
+	}
+	if fault.Status != 0 {
+		http.Error(w, http.StatusText(fault.Status), fault.Status)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.quota == 0 {
+		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+	if s.quota > 0 {
+		s.quota--
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(s.page(r)))
+}
+
+// page renders one page of results for a request; s.mu must be held
+func (s *Server) page(r *http.Request) string {
+	path := r.URL.Path
+	results := s.data[path]
+
+	size := s.pageSize
+	limit, _ := strconv.Atoi(r.URL.Query().Get("l"))
+	if limit > 0 {
+		size = limit
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page = max(page, 1)
+
+	start := min((page-1)*size, len(results))
+	end := min(start+size, len(results))
+
+	var b strings.Builder
+	s.comment(&b, "%s For: %s", title(path), target(path))
+	s.comment(&b, "Entries: %d/%d", end-start, len(results))
+	if s.quota >= 0 {
+		s.comment(&b, "Rate Limit: You can make %d requests", s.quota)
+	}
+	if end < len(results) {
+		next := fmt.Sprintf("%s%s?page=%d", s.URL, path, page+1)
+		if limit > 0 {
+			next += fmt.Sprintf("&l=%d", limit)
+		}
+		s.comment(&b, "Next Page: %s", next)
+	}
+	for _, result := range results[start:end] {
+		b.WriteString(result)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// comment writes a ;; line, colored like the real API if enabled
+func (s *Server) comment(b *strings.Builder, format string, args ...any) {
+	line := ";;" + fmt.Sprintf(format, args...)
+	if s.color {
+		line = colorComment + line + colorReset
+	}
+	b.WriteString(line)
+	b.WriteByte('\n')
+}
+
+// title names the kind of lookup a path is for
+func title(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/sb/"):
+		return "Subdomains"
+	case strings.HasPrefix(path, "/cn/"):
+		return "CNAMEs"
+	default:
+		return "Domains"
+	}
+}
+
+// target returns the IP or domain a path looks up
+func target(path string) string {
+	path = strings.TrimPrefix(path, "/sb/")
+	path = strings.TrimPrefix(path, "/cn/")
+	return strings.TrimPrefix(path, "/")
+}
@@ -0,0 +1,176 @@
+package ipthctest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+	"github.com/DFC302/ipthc/pkg/ipthc/ipthctest"
+)
+
+func subdomains(n int) []string {
+	subs := make([]string, n)
+	for i := range subs {
+		subs[i] = fmt.Sprintf("sub%d.example.com", i+1)
+	}
+	return subs
+}
+
+func TestServer_Pagination(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	server.AddSubdomains("example.com", subdomains(250)...)
+
+	client := ipthc.NewClient(server.URL, 0, 0, false)
+	results, err := client.QuerySubdomains(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("QuerySubdomains failed: %v", err)
+	}
+
+	if !slices.Equal(results, subdomains(250)) {
+		t.Errorf("expected all 250 subdomains in order, got %d", len(results))
+	}
+	want := []string{"/sb/example.com", "/sb/example.com?page=2", "/sb/example.com?page=3"}
+	if got := server.Requests(); !slices.Equal(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+}
+
+func TestServer_ResponseFormat(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	server.AddDNS("1.1.1.1", "one.one.one.one", "1dot1dot1dot1.cloudflare-dns.com", "extra.example.com")
+	server.SetPageSize(2)
+	server.SetQuota(10)
+
+	resp, err := http.Get(server.URL + "/1.1.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(data)
+
+	for _, want := range []string{"\x1b[0;33m;;Entries: 2/3\x1b[0m", ";;Rate Limit: You can make 9 requests", ";;Next Page: " + server.URL + "/1.1.1.1?page=2"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("response missing %q:\n%s", want, body)
+		}
+	}
+
+	parsed := ipthc.NewResponseParser(false).Parse(body)
+	if parsed.CurrentCount != 2 || parsed.TotalCount != 3 || ipthc.ParseRemaining(body) != 9 || !parsed.HasMore() {
+		t.Errorf("unexpected parse of fake response: %+v", parsed)
+	}
+	if !slices.Equal(parsed.Data, []string{"one.one.one.one", "1dot1dot1dot1.cloudflare-dns.com"}) {
+		t.Errorf("unexpected data: %v", parsed.Data)
+	}
+}
+
+func TestServer_LimitAndUnknownInput(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	server.AddCNAME("cdn.example.net", "a.example.com", "b.example.com", "c.example.com")
+
+	client := ipthc.NewClient(server.URL, 2, 0, false)
+	results, err := client.QueryCNAME(context.Background(), "cdn.example.net")
+	if err != nil {
+		t.Fatalf("QueryCNAME failed: %v", err)
+	}
+	if !slices.Equal(results, []string{"a.example.com", "b.example.com"}) {
+		t.Errorf("l=2 should return the first 2 results, got %v", results)
+	}
+
+	results, err = client.QueryCNAME(context.Background(), "unknown.example.net")
+	if err != nil || len(results) != 0 {
+		t.Errorf("unknown input should return no results, got %v, %v", results, err)
+	}
+}
+
+func TestServer_QuotaDepletion(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	server.AddDNS("1.1.1.1", "one.one.one.one")
+	server.SetQuota(2)
+
+	client := ipthc.NewClient(server.URL, 0, 0, false)
+	client.Quota = ipthc.NewQuotaTracker(0, time.Minute, true, false)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.QueryDNS(context.Background(), "1.1.1.1"); err != nil {
+			t.Fatalf("query %d failed: %v", i+1, err)
+		}
+	}
+	if _, err := client.QueryDNS(context.Background(), "1.1.1.1"); !errors.Is(err, ipthc.ErrQuotaExhausted) {
+		t.Errorf("expected ErrQuotaExhausted once the quota is used up, got %v", err)
+	}
+
+	// Clients that ignore the reported quota are refused
+	client.Quota = nil
+	client.Retry = ipthc.RetryPolicy{}
+	_, err := client.QueryDNS(context.Background(), "1.1.1.1")
+	if err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("expected 429 with no quota left, got %v", err)
+	}
+	if server.Quota() != 0 {
+		t.Errorf("expected quota 0, got %d", server.Quota())
+	}
+}
+
+func TestServer_InjectedFaultsAreRetried(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	server.AddSubdomains("example.com", subdomains(3)...)
+	server.SetPageSize(1)
+	server.Inject(ipthctest.Fault{}, ipthctest.Fault{Status: 503}, ipthctest.Fault{Status: 429, RetryAfter: time.Second})
+
+	client := ipthc.NewClient(server.URL, 0, 0, false)
+	client.Retry = ipthc.NewRetryPolicy(2, 10*time.Millisecond)
+
+	results, err := client.QuerySubdomains(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("QuerySubdomains failed: %v", err)
+	}
+	if !slices.Equal(results, subdomains(3)) {
+		t.Errorf("unexpected results: %v", results)
+	}
+
+	// Page 2 failed twice before succeeding; page 1 was never refetched
+	want := []string{"/sb/example.com", "/sb/example.com?page=2", "/sb/example.com?page=2", "/sb/example.com?page=2", "/sb/example.com?page=3"}
+	if got := server.Requests(); !slices.Equal(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+}
+
+func TestServer_SlowResponse(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	server.AddDNS("1.1.1.1", "one.one.one.one")
+	server.Inject(ipthctest.Fault{Delay: 5 * time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	client := ipthc.NewClient(server.URL, 0, 0, false)
+	start := time.Now()
+	if _, err := client.QueryDNS(ctx, "1.1.1.1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("slow response should be abandoned at the deadline, took %v", elapsed)
+	}
+
+	// Only the injected request was slow
+	if _, err := client.QueryDNS(context.Background(), "1.1.1.1"); err != nil {
+		t.Errorf("second query failed: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package ipthc
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ErrPagination is matched by errors.Is for a *PaginationError
+var ErrPagination = errors.New("untrustworthy pagination")
+
+// ErrCountMismatch is matched by errors.Is for a *CountMismatchError
+var ErrCountMismatch = errors.New("result count mismatch")
+
+// PaginationError is returned when a next-page link cannot be followed safely
+// Pages before it have already been delivered to the callback.
+type PaginationError struct {
+	Page   int    // Page the link would have been fetched as
+	URL    string // The offending link
+	Reason string
+}
+
+func (e *PaginationError) Error() string {
+	return fmt.Sprintf("page %d: %s: %s", e.Page, e.Reason, e.URL)
+}
+
+func (e *PaginationError) Unwrap() error { return ErrPagination }
+
+// CountMismatchError is passed to Client.Warn when a query ran to its last
+// page but the number of results fetched differs from the total the API
+// advertised. Every page has been delivered, so the query still succeeds.
+type CountMismatchError struct {
+	Fetched int
+	Total   int
+}
+
+func (e *CountMismatchError) Error() string {
+	return fmt.Sprintf("fetched %d results but the API advertised %d", e.Fetched, e.Total)
+}
+
+func (e *CountMismatchError) Unwrap() error { return ErrCountMismatch }
+
+// pageGuard vets next-page links before they are followed
+type pageGuard struct {
+	host string         // Host of the configured base URL ("" skips the check)
+	seen map[string]int // Links already fetched, with the page they were
+}
+
+// newPageGuard creates a guard for a query against baseURL
+func newPageGuard(baseURL string) *pageGuard {
+	g := &pageGuard{seen: make(map[string]int)}
+	if u, err := url.Parse(baseURL); err == nil {
+		g.host = u.Host
+	}
+	return g
+}
+
+// check records link as page and returns an error if following it would
+// leave the API host or revisit a page, which would loop until the page cap
+func (g *pageGuard) check(link string, page int) error {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return &PaginationError{Page: page, URL: link, Reason: "next page link is not an http(s) URL"}
+	}
+	if g.host != "" && !strings.EqualFold(u.Host, g.host) {
+		return &PaginationError{Page: page, URL: link, Reason: "next page link leaves API host " + g.host}
+	}
+	if prev, ok := g.seen[link]; ok {
+		return &PaginationError{Page: page, URL: link, Reason: fmt.Sprintf("next page link repeats page %d", prev)}
+	}
+	g.seen[link] = page
+	return nil
+}
+
+// WarnFunc receives a problem that did not fail a query, such as a
+// *CountMismatchError
+type WarnFunc func(mode, input string, warning error)
+
+// reconcile compares the results fetched by a finished query with the
+// advertised total; a total of 0 means the API did not report one
+func (c *Client) reconcile(mode, input string, fetched, total int) {
+	if total == 0 || fetched == total {
+		return
+	}
+	c.warn(mode, input, &CountMismatchError{Fetched: fetched, Total: total})
+}
+
+// warn hands a warning to c.Warn, or prints it in verbose mode
+func (c *Client) warn(mode, input string, warning error) {
+	if c.Warn != nil {
+		c.Warn(mode, input, warning)
+		return
+	}
+	if c.Verbose {
+		fmt.Fprintf(os.Stderr, "Warning: %s %s: %v\n", mode, input, warning)
+	}
+}
@@ -0,0 +1,181 @@
+package ipthc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scriptedServer answers the n-th request with pages[n], replacing {url} with
+// the server's URL
+func scriptedServer(t *testing.T, pages ...string) (*httptest.Server, *int) {
+	t.Helper()
+	requests := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := pages[min(requests, len(pages)-1)]
+		requests++
+		w.Write([]byte(strings.ReplaceAll(page, "{url}", server.URL)))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestPagination_RepeatedLinkIsALoop(t *testing.T) {
+	server, requests := scriptedServer(t,
+		";;Entries: 1/3\n;;Next Page: {url}/sb/example.com?page=2\na.example.com",
+		";;Entries: 1/3\n;;Next Page: {url}/sb/example.com?page=2\nb.example.com",
+	)
+
+	client := NewClient(server.URL, 0, 0, false)
+	results, err := client.QuerySubdomains(context.Background(), "example.com")
+
+	var pe *PaginationError
+	if !errors.As(err, &pe) || !errors.Is(err, ErrPagination) {
+		t.Fatalf("expected a PaginationError, got %v", err)
+	}
+	if pe.Page != 3 || !strings.Contains(pe.Reason, "repeats page 2") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if *requests != 2 || len(results) != 2 {
+		t.Errorf("expected 2 requests and 2 results before stopping, got %d and %v", *requests, results)
+	}
+}
+
+func TestPagination_LinkBackToFirstPageIsALoop(t *testing.T) {
+	server, requests := scriptedServer(t,
+		";;Entries: 1/3\n;;Next Page: {url}/sb/example.com\na.example.com",
+	)
+
+	client := NewClient(server.URL, 0, 0, false)
+	_, err := client.QuerySubdomains(context.Background(), "example.com")
+
+	if !errors.Is(err, ErrPagination) || !strings.Contains(err.Error(), "repeats page 1") {
+		t.Fatalf("expected a loop back to page 1, got %v", err)
+	}
+	if *requests != 1 {
+		t.Errorf("expected 1 request, got %d", *requests)
+	}
+}
+
+func TestPagination_LinkMustStayOnAPIHost(t *testing.T) {
+	elsewhere, elsewhereRequests := scriptedServer(t, ";;Entries: 1/1\nleaked.example.com")
+	server, _ := scriptedServer(t,
+		";;Entries: 1/2\n;;Next Page: "+elsewhere.URL+"/sb/example.com?page=2\na.example.com",
+	)
+
+	client := NewClient(server.URL, 0, 0, false)
+	_, err := client.QuerySubdomains(context.Background(), "example.com")
+
+	if !errors.Is(err, ErrPagination) || !strings.Contains(err.Error(), "leaves API host") {
+		t.Fatalf("expected an off-host link to be refused, got %v", err)
+	}
+	if *elsewhereRequests != 0 {
+		t.Errorf("the other host must not be contacted, got %d requests", *elsewhereRequests)
+	}
+}
+
+func TestPagination_CountMismatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		pages   []string
+		fetched int
+		total   int
+	}{
+		{
+			name: "pages short of total",
+			pages: []string{
+				";;Entries: 2/5\n;;Next Page: {url}/sb/example.com?page=2\na.example.com\nb.example.com",
+				";;Entries: 2/5\nc.example.com\nd.example.com",
+			},
+			fetched: 4, total: 5,
+		},
+		{
+			name:    "more advertised but no next link",
+			pages:   []string{";;Entries: 2/5\na.example.com\nb.example.com"},
+			fetched: 2, total: 5,
+		},
+		{
+			name:    "entries line disagrees with lines",
+			pages:   []string{";;Entries: 3/3\na.example.com\nb.example.com"},
+			fetched: 2, total: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := scriptedServer(t, tt.pages...)
+			client := NewClient(server.URL, 0, 0, false)
+			var warnings []error
+			client.Warn = func(mode, input string, warning error) {
+				if mode != ModeSubs || input != "example.com" {
+					t.Errorf("warning attributed to %s %s", mode, input)
+				}
+				warnings = append(warnings, warning)
+			}
+
+			// Every page was delivered, so the query itself succeeds
+			results, err := client.QuerySubdomains(context.Background(), "example.com")
+			if err != nil {
+				t.Fatalf("a count mismatch should not fail the query, got %v", err)
+			}
+			if len(results) != tt.fetched {
+				t.Errorf("every fetched result should still be delivered, got %v", results)
+			}
+
+			for _, err := range client.Results(context.Background(), ModeSubs, "example.com") {
+				if err != nil {
+					t.Fatalf("Results should not surface a count mismatch, got %v", err)
+				}
+			}
+
+			if len(warnings) != 2 {
+				t.Fatalf("expected a warning per query, got %v", warnings)
+			}
+			var mismatch *CountMismatchError
+			if !errors.As(warnings[0], &mismatch) || !errors.Is(warnings[0], ErrCountMismatch) {
+				t.Fatalf("expected a CountMismatchError, got %v", warnings[0])
+			}
+			if mismatch.Fetched != tt.fetched || mismatch.Total != tt.total {
+				t.Errorf("got %+v, want fetched %d total %d", mismatch, tt.fetched, tt.total)
+			}
+		})
+	}
+}
+
+func TestPagination_NoMismatchWhenUncountable(t *testing.T) {
+	// An explicit limit returns fewer than the total by design
+	server, _ := scriptedServer(t, ";;Entries: 2/5\na.example.com\nb.example.com")
+	client := NewClient(server.URL, 2, 0, false)
+	client.Warn = warnUnexpected(t)
+	if _, err := client.QuerySubdomains(context.Background(), "example.com"); err != nil {
+		t.Errorf("limited query should not be reconciled, got %v", err)
+	}
+
+	// No ;;Entries: line means no total to compare with
+	server, _ = scriptedServer(t, "a.example.com\nb.example.com")
+	client = NewClient(server.URL, 0, 0, false)
+	client.Warn = warnUnexpected(t)
+	if _, err := client.QuerySubdomains(context.Background(), "example.com"); err != nil {
+		t.Errorf("response without a total should not be reconciled, got %v", err)
+	}
+
+	// A checkpoint without a fetched count cannot be reconciled after resuming
+	server, _ = scriptedServer(t, ";;Entries: 2/6\nc.example.com\nd.example.com")
+	client = NewClient(server.URL, 0, 0, false)
+	client.Warn = warnUnexpected(t)
+	from := &Checkpoint{Page: 1, Total: 6, NextPageURL: server.URL + "/sb/example.com?page=2"}
+	if err := client.QueryFrom(context.Background(), ModeSubs, "example.com", from, func([]string, int, int) error { return nil }, nil); err != nil {
+		t.Errorf("resumed legacy checkpoint should not be reconciled, got %v", err)
+	}
+}
+
+// warnUnexpected fails the test if the client reports any warning
+func warnUnexpected(t *testing.T) WarnFunc {
+	return func(mode, input string, warning error) {
+		t.Errorf("unexpected warning for %s %s: %v", mode, input, warning)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package ipthc
 
 import (
 	"fmt"
@@ -45,6 +45,9 @@ var entriesRegex = regexp.MustCompile(`;;Entries:\s*(\d+)/(\d+)`)
 // Regular expression to match ;;Next Page: URL
 var nextPageRegex = regexp.MustCompile(`;;Next Page:.*?(https?://[^\s]+)`)
 
+// Regular expression to match ;;Rate Limit: You can make N requests
+var rateLimitRegex = regexp.MustCompile(`;;Rate Limit:.*?(\d+)\s+requests?`)
+
 // Regular expression to strip ANSI color codes
 var ansiRegex = regexp.MustCompile(`\x1b\[[0-9;]*m`)
 
@@ -67,10 +70,11 @@ func (p *ResponseParser) Parse(body string) *ParseResult {
 			continue
 		}
 
-		// Comment line (starts with ;)
-		if strings.HasPrefix(trimmed, ";") {
-			// Strip ANSI color codes for parsing
-			cleaned := ansiRegex.ReplaceAllString(trimmed, "")
+		// Strip ANSI color codes for parsing
+		cleaned := ansiRegex.ReplaceAllString(trimmed, "")
+
+		// Comment line (starts with ;, possibly after a color code)
+		if strings.HasPrefix(cleaned, ";") {
 
 			// Try to extract pagination info from ;;Entries: line
 			if matches := entriesRegex.FindStringSubmatch(cleaned); matches != nil {
@@ -95,10 +99,38 @@ func (p *ResponseParser) Parse(body string) *ParseResult {
 			continue
 		}
 
-		// Data line - add to results (strip ANSI codes)
-		cleaned := ansiRegex.ReplaceAllString(trimmed, "")
+		// Data line - add to results
 		result.Data = append(result.Data, cleaned)
 	}
 
 	return result
 }
+
+// parseRateLimit extracts the remaining quota from a cleaned ;;Rate Limit: line
+func parseRateLimit(line string) (int, bool) {
+	matches := rateLimitRegex.FindStringSubmatch(line)
+	if len(matches) != 2 {
+		return 0, false
+	}
+	remaining, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0, false
+	}
+	return remaining, true
+}
+
+// ParseRemaining returns the remaining API quota reported in a response body,
+// or -1 if the body has no ;;Rate Limit: line
+// The client reads it from every live response to feed its QuotaTracker.
+func ParseRemaining(body string) int {
+	for _, line := range strings.Split(body, "\n") {
+		cleaned := ansiRegex.ReplaceAllString(strings.TrimSpace(line), "")
+		if !strings.HasPrefix(cleaned, ";") {
+			continue
+		}
+		if remaining, ok := parseRateLimit(cleaned); ok {
+			return remaining
+		}
+	}
+	return -1
+}
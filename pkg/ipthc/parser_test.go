@@ -1,4 +1,4 @@
-package main
+package ipthc
 
 import (
 	"bytes"
@@ -156,3 +156,26 @@ sub2.example.com`
 		t.Errorf("TotalCount should be 0 when no ;;Entries line")
 	}
 }
+
+func TestParseRemaining(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected int
+	}{
+		{"plain", ";;Rate Limit: You can make 249 requests\nsub.example.com", 249},
+		{"ansi", "\x1b[0;33m;;Rate Limit: You can make \x1b[1m0\x1b[0m requests\x1b[0m\nsub.example.com", 0},
+		{"singular", ";;Rate Limit: You can make 1 request", 1},
+		{"after entries", ";;Entries: 1/1\n;;Rate Limit: You can make 42 requests\nsub.example.com", 42},
+		{"absent", ";;Entries: 1/1\nsub.example.com", -1},
+		{"no comments", "sub.example.com", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseRemaining(tt.input); got != tt.expected {
+				t.Errorf("ParseRemaining = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
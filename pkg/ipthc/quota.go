@@ -0,0 +1,136 @@
+package ipthc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultQuotaLow   = 20
+	DefaultQuotaPause = 60 * time.Second
+	quotaMaxSlowdown  = 5 * time.Second
+)
+
+// ErrQuotaExhausted is returned when the API quota runs out and the tracker is set to stop
+// It matches ErrRateLimited.
+var ErrQuotaExhausted error = quotaError{}
+
+// QuotaTracker throttles requests based on the ;;Rate Limit: quota reported by the API.
+// Requests slow down progressively once the remaining quota drops to Low, and when it
+// reaches zero the tracker either pauses every worker for Pause or stops the run.
+type QuotaTracker struct {
+	Low         int           // Remaining quota at which slowdown begins (0 disables slowdown)
+	Pause       time.Duration // How long to pause once exhausted
+	StopOnEmpty bool          // Return ErrQuotaExhausted instead of pausing
+	Verbose     bool
+
+	mu          sync.Mutex
+	remaining   int // -1 until the API reports a quota
+	pausedUntil time.Time
+}
+
+// NewQuotaTracker creates a quota tracker with no known quota
+func NewQuotaTracker(low int, pause time.Duration, stopOnEmpty bool, verbose bool) *QuotaTracker {
+	return &QuotaTracker{
+		Low:         low,
+		Pause:       pause,
+		StopOnEmpty: stopOnEmpty,
+		Verbose:     verbose,
+		remaining:   -1,
+	}
+}
+
+// Update records the remaining quota from a response (negative values are ignored)
+func (q *QuotaTracker) Update(remaining int) {
+	if q == nil || remaining < 0 {
+		return
+	}
+	q.mu.Lock()
+	q.remaining = remaining
+	q.mu.Unlock()
+}
+
+// Remaining returns the last reported quota, or -1 if unknown
+func (q *QuotaTracker) Remaining() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.remaining
+}
+
+// Wait blocks as needed before a request is made
+// Returns ErrQuotaExhausted if the quota is used up and StopOnEmpty is set,
+// or ctx's error if it is done while waiting
+func (q *QuotaTracker) Wait(ctx context.Context) error {
+	if q == nil {
+		return ctx.Err()
+	}
+
+	q.mu.Lock()
+	now := time.Now()
+	owner := false
+
+	if q.remaining == 0 {
+		if q.StopOnEmpty {
+			q.mu.Unlock()
+			return ErrQuotaExhausted
+		}
+		// First worker to notice starts the pause; the quota is unknown again
+		// until the next response reports it
+		q.pausedUntil = now.Add(q.Pause)
+		q.remaining = -1
+		owner = true
+	}
+
+	until := q.pausedUntil
+	delay := q.slowdown()
+	q.mu.Unlock()
+
+	if until.After(now) {
+		if owner {
+			return countdown(ctx, until)
+		}
+		return sleep(ctx, until.Sub(now))
+	}
+
+	if delay > 0 {
+		if q.Verbose {
+			fmt.Fprintf(os.Stderr, "Quota low (%d requests left), slowing down by %v\n", q.Remaining(), delay)
+		}
+		return sleep(ctx, delay)
+	}
+	return ctx.Err()
+}
+
+// slowdown returns the extra delay for the current quota, growing linearly
+// from nothing at Low to quotaMaxSlowdown at one request left
+// Caller must hold q.mu
+func (q *QuotaTracker) slowdown() time.Duration {
+	if q.Low <= 0 || q.remaining < 0 || q.remaining > q.Low {
+		return 0
+	}
+	used := q.Low - q.remaining + 1
+	return quotaMaxSlowdown * time.Duration(used) / time.Duration(q.Low+1)
+}
+
+// countdown sleeps until the deadline while showing the time left on stderr
+func countdown(ctx context.Context, until time.Time) error {
+	for {
+		left := time.Until(until)
+		if left <= 0 {
+			break
+		}
+		fmt.Fprintf(os.Stderr, "\rAPI quota exhausted, resuming in %v...  ", left.Round(time.Second))
+		if left > time.Second {
+			left = time.Second
+		}
+		if err := sleep(ctx, left); err != nil {
+			fmt.Fprintln(os.Stderr)
+			return err
+		}
+	}
+	fmt.Fprintln(os.Stderr, "\rAPI quota pause finished, resuming.          ")
+	return nil
+}
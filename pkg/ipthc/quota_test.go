@@ -0,0 +1,97 @@
+package ipthc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQuotaTracker_Slowdown(t *testing.T) {
+	q := NewQuotaTracker(10, time.Second, false, false)
+
+	tests := []struct {
+		remaining int
+		expected  time.Duration
+	}{
+		{-1, 0},
+		{50, 0},
+		{11, 0},
+		{10, quotaMaxSlowdown / 11},
+		{1, quotaMaxSlowdown * 10 / 11},
+	}
+
+	for _, tt := range tests {
+		q.remaining = tt.remaining
+		if got := q.slowdown(); got != tt.expected {
+			t.Errorf("slowdown() with %d remaining = %v, want %v", tt.remaining, got, tt.expected)
+		}
+	}
+}
+
+func TestQuotaTracker_UpdateIgnoresUnknown(t *testing.T) {
+	q := NewQuotaTracker(10, time.Second, false, false)
+
+	q.Update(42)
+	q.Update(-1)
+
+	if got := q.Remaining(); got != 42 {
+		t.Errorf("Remaining() = %d, want 42", got)
+	}
+}
+
+func TestQuotaTracker_StopOnEmpty(t *testing.T) {
+	q := NewQuotaTracker(0, time.Second, true, false)
+	q.Update(0)
+
+	if err := q.Wait(context.Background()); !errors.Is(err, ErrQuotaExhausted) {
+		t.Errorf("Wait() = %v, want ErrQuotaExhausted", err)
+	}
+}
+
+func TestQuotaTracker_PauseWhenExhausted(t *testing.T) {
+	q := NewQuotaTracker(0, 50*time.Millisecond, false, false)
+	q.Update(0)
+
+	start := time.Now()
+	if err := q.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() returned %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected pause of 50ms, took %v", elapsed)
+	}
+
+	// Quota is unknown after the pause, so the next request goes straight through
+	start = time.Now()
+	q.Wait(context.Background())
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("second Wait() should not pause again, took %v", elapsed)
+	}
+}
+
+func TestClient_StopsWhenQuotaExhausted(t *testing.T) {
+	requestCount := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.Write([]byte(";;Entries: 1/3\n;;Rate Limit: You can make 0 requests\n;;Next Page: " + server.URL + "/sb/example.com?page=2\nsub1"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 0, 0, false)
+	client.Quota = NewQuotaTracker(0, time.Second, true, false)
+
+	results, err := client.QuerySubdomains(context.Background(), "example.com")
+
+	if !errors.Is(err, ErrQuotaExhausted) {
+		t.Errorf("expected ErrQuotaExhausted, got %v", err)
+	}
+	if requestCount != 1 {
+		t.Errorf("expected client to stop after 1 request, got %d", requestCount)
+	}
+	if len(results) != 1 {
+		t.Errorf("first page results should still be delivered, got %v", results)
+	}
+}
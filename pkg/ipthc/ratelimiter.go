@@ -0,0 +1,65 @@
+package ipthc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket shared by every goroutine issuing API requests.
+// The bucket holds a single token that refills once per interval, so the
+// aggregate request rate never exceeds one request per interval no matter how
+// many workers are waiting on it.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewRateLimiter creates a rate limiter allowing one request every delay seconds.
+// A delay of 0 disables rate limiting.
+func NewRateLimiter(delay float64) *RateLimiter {
+	return &RateLimiter{
+		interval: time.Duration(delay * float64(time.Second)),
+	}
+}
+
+// Wait blocks until the caller is allowed to make a request or ctx is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	if l.interval <= 0 {
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+
+	// Reserve the next free slot, then sleep outside the lock so other
+	// goroutines can queue up behind us
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	return sleep(ctx, wait)
+}
+
+// sleep waits for d, returning early with ctx's error if it is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,102 @@
+package ipthc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_SerializesConcurrentWaiters(t *testing.T) {
+	limiter := NewRateLimiter(0.02)
+
+	var mu sync.Mutex
+	var stamps []time.Time
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Wait(context.Background())
+			mu.Lock()
+			stamps = append(stamps, time.Now())
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i].Before(stamps[j]) })
+
+	// 10 requests at one per 20ms must span at least 9 intervals
+	if span := stamps[len(stamps)-1].Sub(stamps[0]); span < 9*20*time.Millisecond-5*time.Millisecond {
+		t.Errorf("10 waiters finished within %v, expected >= 180ms", span)
+	}
+}
+
+func TestRateLimiter_Disabled(t *testing.T) {
+	limiter := NewRateLimiter(0)
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		limiter.Wait(context.Background())
+	}
+
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("disabled limiter should not block, took %v", elapsed)
+	}
+}
+
+func TestRateLimiter_AggregateRateAcrossWorkers(t *testing.T) {
+	const interval = 30 * time.Millisecond
+
+	for _, workers := range []int{1, 4, 16} {
+		var mu sync.Mutex
+		var stamps []time.Time
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			stamps = append(stamps, time.Now())
+			mu.Unlock()
+			w.Write([]byte(";;Entries: 1/1\nok"))
+		}))
+
+		client := NewClient(server.URL, 0, interval.Seconds(), false)
+
+		jobs := make(chan string)
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ip := range jobs {
+					client.Query(context.Background(), ModeDNS, ip, collect(new([]string)))
+				}
+			}()
+		}
+		for i := 0; i < 12; i++ {
+			jobs <- "1.1.1.1"
+		}
+		close(jobs)
+		wg.Wait()
+		server.Close()
+
+		if len(stamps) != 12 {
+			t.Fatalf("workers=%d: expected 12 requests, got %d", workers, len(stamps))
+		}
+
+		sort.Slice(stamps, func(i, j int) bool { return stamps[i].Before(stamps[j]) })
+
+		// The n-th request may not arrive before n intervals have passed;
+		// allow a little scheduling jitter between the limiter and the handler
+		for i := 1; i < len(stamps); i++ {
+			if elapsed := stamps[i].Sub(stamps[0]); elapsed < time.Duration(i)*interval-15*time.Millisecond {
+				t.Errorf("workers=%d: request %d arrived after %v, expected >= %v", workers, i, elapsed, time.Duration(i)*interval)
+			}
+		}
+		if span := stamps[len(stamps)-1].Sub(stamps[0]); span < 11*interval-10*time.Millisecond {
+			t.Errorf("workers=%d: 12 requests spanned %v, expected >= %v", workers, span, 11*interval)
+		}
+	}
+}
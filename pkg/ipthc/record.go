@@ -0,0 +1,182 @@
+package ipthc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotRecorded is returned by a Replayer for a request it has no recording of
+var ErrNotRecorded = errors.New("no recording for request")
+
+// Recording is one raw API response saved by a Recorder
+type Recording struct {
+	URL     string      `json:"url"`
+	Attempt int         `json:"attempt"` // 1 for the first response to URL, 2 for a retry, ...
+	Status  int         `json:"status"`
+	Header  http.Header `json:"header,omitempty"`
+	Body    string      `json:"body"`
+	Time    time.Time   `json:"time"`
+}
+
+// recordingPath returns the file holding the attempt-th response to url
+func recordingPath(dir, url string, attempt int) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, fmt.Sprintf("%s-%d.json", hex.EncodeToString(sum[:8]), attempt))
+}
+
+// Recorder is an http.RoundTripper that saves every response passing through
+// it, including error statuses, to a directory a Replayer can serve from
+type Recorder struct {
+	Dir  string
+	Next http.RoundTripper // Transport making the real requests (nil uses http.DefaultTransport)
+
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+// NewRecorder creates a recorder writing to dir, creating the directory if needed
+func NewRecorder(dir string, next http.RoundTripper) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	return &Recorder{Dir: dir, Next: next, attempts: make(map[string]int)}, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := r.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	url := req.URL.String()
+	r.mu.Lock()
+	r.attempts[url]++
+	attempt := r.attempts[url]
+	r.mu.Unlock()
+
+	data, err := json.MarshalIndent(Recording{
+		URL:     url,
+		Attempt: attempt,
+		Status:  resp.StatusCode,
+		Header:  resp.Header,
+		Body:    string(body),
+		Time:    time.Now().UTC(),
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(recordingPath(r.Dir, url, attempt), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to record response: %w", err)
+	}
+	return resp, nil
+}
+
+// Replayer is an http.RoundTripper that answers requests from a Recorder's
+// directory without touching the network
+// Repeated requests for a URL get its recorded responses in order, so
+// failures that were retried are replayed too; once they run out the last
+// one is served again.
+type Replayer struct {
+	recordings map[string][]Recording // By URL, ordered by attempt
+
+	mu     sync.Mutex
+	served map[string]int
+}
+
+// NewReplayer loads every recording in dir
+func NewReplayer(dir string) (*Replayer, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recordings in %s", dir)
+	}
+
+	r := &Replayer{recordings: make(map[string][]Recording), served: make(map[string]int)}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recording: %w", err)
+		}
+		var rec Recording
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("invalid recording %s: %w", file, err)
+		}
+		if rec.URL == "" || rec.Attempt < 1 {
+			return nil, fmt.Errorf("invalid recording %s: missing url or attempt", file)
+		}
+
+		recs := r.recordings[rec.URL]
+		for len(recs) < rec.Attempt {
+			recs = append(recs, Recording{})
+		}
+		recs[rec.Attempt-1] = rec
+		r.recordings[rec.URL] = recs
+	}
+
+	for url, recs := range r.recordings {
+		for i, rec := range recs {
+			if rec.URL == "" {
+				return nil, fmt.Errorf("recording of attempt %d for %s is missing", i+1, url)
+			}
+		}
+	}
+	return r, nil
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	url := req.URL.String()
+	recs := r.recordings[url]
+	if len(recs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotRecorded, url)
+	}
+
+	r.mu.Lock()
+	i := min(r.served[url], len(recs)-1)
+	r.served[url]++
+	r.mu.Unlock()
+
+	rec := recs[i]
+	header := rec.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode:    rec.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(rec.Body)),
+		ContentLength: int64(len(rec.Body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,124 @@
+package ipthc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DFC302/ipthc/pkg/ipthc/ipthctest"
+)
+
+func TestRecorder_ReplayReproducesRun(t *testing.T) {
+	dir := t.TempDir()
+
+	server := ipthctest.NewServer()
+	var subs []string
+	for i := 1; i <= 5; i++ {
+		subs = append(subs, fmt.Sprintf("sub%d.example.com", i))
+	}
+	server.AddSubdomains("example.com", subs...)
+	server.SetPageSize(2)
+	server.SetQuota(50)
+	server.Inject(ipthctest.Fault{}, ipthctest.Fault{Status: 503, RetryAfter: time.Second})
+
+	recorder, err := NewRecorder(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(server.URL, 0, 0, false)
+	client.HTTPClient.Transport = recorder
+	client.Retry = NewRetryPolicy(2, 10*time.Millisecond)
+
+	recorded, err := client.QuerySubdomains(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("recording run failed: %v", err)
+	}
+	server.Close()
+
+	// 3 pages plus the failed attempt at page 2
+	if files, _ := os.ReadDir(dir); len(files) != 4 {
+		t.Fatalf("expected 4 recordings, got %d", len(files))
+	}
+
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []int
+	client = NewClient(server.URL, 0, 0, false)
+	client.HTTPClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := replayer.RoundTrip(req)
+		if err == nil {
+			statuses = append(statuses, resp.StatusCode)
+		}
+		return resp, err
+	})
+	client.Retry = NewRetryPolicy(2, 10*time.Millisecond)
+	client.Quota = NewQuotaTracker(0, time.Minute, true, false)
+
+	replayed, err := client.QuerySubdomains(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if !slices.Equal(replayed, recorded) || !slices.Equal(replayed, subs) {
+		t.Errorf("replayed %v, recorded %v", replayed, recorded)
+	}
+	if want := []int{200, 503, 200, 200}; !slices.Equal(statuses, want) {
+		t.Errorf("replayed statuses %v, want %v", statuses, want)
+	}
+	if remaining := client.Quota.Remaining(); remaining != 47 {
+		t.Errorf("replayed quota should be 47, got %d", remaining)
+	}
+}
+
+func TestReplayer_MissingRecordingIsNotRetried(t *testing.T) {
+	dir := t.TempDir()
+	server := ipthctest.NewServer()
+	server.AddDNS("1.1.1.1", "one.one.one.one")
+
+	recorder, err := NewRecorder(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(server.URL, 0, 0, false)
+	client.HTTPClient.Transport = recorder
+	if _, err := client.QueryDNS(context.Background(), "1.1.1.1"); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = NewClient(server.URL, 0, 0, false)
+	client.HTTPClient.Transport = replayer
+	client.Retry = NewRetryPolicy(3, 10*time.Second)
+
+	start := time.Now()
+	_, err = client.QueryDNS(context.Background(), "8.8.8.8")
+	if !errors.Is(err, ErrNotRecorded) {
+		t.Fatalf("expected ErrNotRecorded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("missing recordings should fail without retrying, took %v", elapsed)
+	}
+}
+
+func TestReplayer_EmptyDir(t *testing.T) {
+	if _, err := NewReplayer(t.TempDir()); err == nil {
+		t.Error("expected an error for a directory without recordings")
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,46 @@
+package ipthc
+
+import (
+	"context"
+	"errors"
+	"iter"
+)
+
+// Result is a single result yielded by Client.Results
+type Result struct {
+	Mode  string // Query mode that produced the result
+	Input string // IP or domain that was queried
+	Value string // Hostname or domain returned by the API
+	Page  int    // Page the result arrived on
+	Total int    // Total results advertised by the API
+}
+
+// errStopIteration ends a query once the consumer of Results stops ranging
+var errStopIteration = errors.New("iteration stopped")
+
+// Results returns an iterator over every result of a lookup
+// Pages are fetched lazily as the loop advances, so breaking out of it stops
+// pagination. A failed query yields a single error, after any results that
+// were already received.
+//
+//	for r, err := range client.Results(ctx, ipthc.ModeSubs, "example.com") {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(r.Value)
+//	}
+func (c *Client) Results(ctx context.Context, mode, input string) iter.Seq2[Result, error] {
+	return func(yield func(Result, error) bool) {
+		err := c.Query(ctx, mode, input, func(results []string, page, total int) error {
+			for _, value := range results {
+				if !yield(Result{Mode: mode, Input: input, Value: value, Page: page, Total: total}, nil) {
+					return errStopIteration
+				}
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			yield(Result{Mode: mode, Input: input}, err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package ipthc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pagedServer serves pages of two results each, counting requests
+// Pages listed in fail answer with a 500.
+func pagedServer(t *testing.T, pages int, requests *int, fail ...int) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		for _, f := range fail {
+			if page == f {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+
+		var body strings.Builder
+		fmt.Fprintf(&body, ";;Entries: 2/%d\n", pages*2)
+		if page < pages {
+			fmt.Fprintf(&body, ";;Next Page: %s/sb/example.com?page=%d\n", server.URL, page+1)
+		}
+		fmt.Fprintf(&body, "a%d.example.com\nb%d.example.com\n", page, page)
+		w.Write([]byte(body.String()))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient_ResultsAllPages(t *testing.T) {
+	requests := 0
+	client := NewClient(pagedServer(t, 3, &requests).URL, 0, 0, false)
+
+	var values []string
+	for r, err := range client.Results(context.Background(), ModeSubs, "example.com") {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if r.Mode != ModeSubs || r.Input != "example.com" || r.Total != 6 {
+			t.Errorf("unexpected provenance: %+v", r)
+		}
+		values = append(values, fmt.Sprintf("%s@%d", r.Value, r.Page))
+	}
+
+	want := "a1.example.com@1 b1.example.com@1 a2.example.com@2 b2.example.com@2 a3.example.com@3 b3.example.com@3"
+	if got := strings.Join(values, " "); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+}
+
+func TestClient_ResultsBreakStopsFetching(t *testing.T) {
+	requests := 0
+	client := NewClient(pagedServer(t, 5, &requests).URL, 0, 0, false)
+
+	n := 0
+	for _, err := range client.Results(context.Background(), ModeSubs, "example.com") {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n++; n == 3 {
+			break
+		}
+	}
+
+	// The third result is on page 2, so page 3 must never be requested
+	if requests != 2 {
+		t.Errorf("expected 2 requests after breaking on page 2, got %d", requests)
+	}
+}
+
+func TestClient_ResultsPageErrorInline(t *testing.T) {
+	requests := 0
+	client := NewClient(pagedServer(t, 3, &requests, 2).URL, 0, 0, false)
+	client.Retry = fastRetry
+
+	var values []string
+	var errs []error
+	for r, err := range client.Results(context.Background(), ModeSubs, "example.com") {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		values = append(values, r.Value)
+	}
+
+	if len(values) != 2 {
+		t.Errorf("expected the 2 results of page 1 before the error, got %v", values)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "page 2") || !strings.Contains(errs[0].Error(), "500") {
+		t.Errorf("expected one page 2 error, got %v", errs)
+	}
+}
+
+func TestClient_ResultsCancelled(t *testing.T) {
+	requests := 0
+	client := NewClient(pagedServer(t, 3, &requests).URL, 0, 0, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var last error
+	for r, err := range client.Results(ctx, ModeSubs, "example.com") {
+		if err != nil {
+			last = err
+			continue
+		}
+		if r.Page == 1 {
+			cancel()
+		}
+	}
+
+	if !errors.Is(last, context.Canceled) {
+		t.Fatalf("expected a cancellation error, got %v", last)
+	}
+	if requests != 1 {
+		t.Errorf("expected 1 request before cancelling, got %d", requests)
+	}
+}
@@ -0,0 +1,97 @@
+package ipthc
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultRetries      = 3
+	DefaultRetryMaxWait = 30 * time.Second
+	defaultRetryBase    = 500 * time.Millisecond
+)
+
+// RetryPolicy controls how transient request failures are retried
+type RetryPolicy struct {
+	MaxRetries int           // Retries after the first attempt (0 disables retrying)
+	BaseWait   time.Duration // Backoff before the first retry, doubled on each attempt
+	MaxWait    time.Duration // Upper bound for any single wait, including Retry-After
+}
+
+// NewRetryPolicy creates a retry policy with the default base backoff
+func NewRetryPolicy(maxRetries int, maxWait time.Duration) RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: maxRetries,
+		BaseWait:   defaultRetryBase,
+		MaxWait:    maxWait,
+	}
+}
+
+// isRetryable reports whether err is worth retrying
+// Transport errors, 429 and 5xx responses are retryable; everything else is permanent
+func isRetryable(err error) bool {
+	var te *transientError
+	if errors.As(err, &te) {
+		return true
+	}
+
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode == http.StatusTooManyRequests || se.StatusCode >= 500
+	}
+
+	return false
+}
+
+// Backoff returns how long to wait before retry number attempt (starting at 0)
+// Waits grow exponentially with jitter in [wait/2, wait), capped at MaxWait.
+// A server-provided Retry-After takes precedence but is still capped.
+func (p RetryPolicy) Backoff(attempt int, err error) time.Duration {
+	var se *StatusError
+	if errors.As(err, &se) && se.RetryAfter > 0 {
+		return p.capWait(se.RetryAfter)
+	}
+
+	wait := p.BaseWait
+	for i := 0; i < attempt && wait < p.MaxWait; i++ {
+		wait *= 2
+	}
+	wait = p.capWait(wait)
+
+	if half := wait / 2; half > 0 {
+		wait = half + rand.N(half)
+	}
+	return wait
+}
+
+func (p RetryPolicy) capWait(wait time.Duration) time.Duration {
+	if p.MaxWait > 0 && wait > p.MaxWait {
+		return p.MaxWait
+	}
+	return wait
+}
+
+// parseRetryAfter parses a Retry-After header given either as seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
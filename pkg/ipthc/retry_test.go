@@ -0,0 +1,200 @@
+package ipthc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fastRetry keeps retry tests quick
+var fastRetry = RetryPolicy{MaxRetries: 3, BaseWait: time.Millisecond, MaxWait: 10 * time.Millisecond}
+
+func TestNewClient_DefaultRetry(t *testing.T) {
+	client := NewClient("https://ip.thc.org", 0, 0, false)
+	if want := NewRetryPolicy(DefaultRetries, DefaultRetryMaxWait); client.Retry != want {
+		t.Errorf("Retry = %+v, want %+v", client.Retry, want)
+	}
+}
+
+func TestClient_RetriesTransientStatus(t *testing.T) {
+	for _, status := range []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		requestCount := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestCount++
+			if requestCount <= 2 {
+				w.WriteHeader(status)
+				return
+			}
+			w.Write([]byte(";;Entries: 1/1\nok.example.com"))
+		}))
+
+		client := NewClient(server.URL, 0, 0, false)
+		client.Retry = fastRetry
+
+		var results []string
+		err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(&results))
+		server.Close()
+
+		if err != nil {
+			t.Fatalf("status %d: expected success after retries, got %v", status, err)
+		}
+		if requestCount != 3 {
+			t.Errorf("status %d: expected 3 requests, got %d", status, requestCount)
+		}
+		if len(results) != 1 || results[0] != "ok.example.com" {
+			t.Errorf("status %d: unexpected results %v", status, results)
+		}
+	}
+}
+
+func TestClient_DoesNotRetryPermanentStatus(t *testing.T) {
+	requestCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 0, 0, false)
+	client.Retry = fastRetry
+
+	err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(new([]string)))
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected 404 error, got %v", err)
+	}
+	if requestCount != 1 {
+		t.Errorf("404 should not be retried, got %d requests", requestCount)
+	}
+}
+
+func TestClient_GivesUpAfterMaxRetries(t *testing.T) {
+	requestCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 0, 0, false)
+	client.Retry = fastRetry
+
+	err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(new([]string)))
+	if err == nil || !strings.Contains(err.Error(), "after 3 retries") {
+		t.Errorf("expected error mentioning retries, got %v", err)
+	}
+	if requestCount != 4 {
+		t.Errorf("expected 1 attempt + 3 retries, got %d requests", requestCount)
+	}
+}
+
+func TestClient_RetriesConnectionErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	client := NewClient(url, 0, 0, false)
+	client.Retry = fastRetry
+
+	err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(new([]string)))
+	if err == nil || !strings.Contains(err.Error(), "after 3 retries") {
+		t.Errorf("connection errors should be retried, got %v", err)
+	}
+}
+
+func TestClient_PaginationResumesFailedPage(t *testing.T) {
+	hits := make(map[string]int)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		hits[page]++
+
+		switch page {
+		case "":
+			w.Write([]byte(";;Entries: 2/4\n;;Next Page: " + server.URL + "/sb/example.com?page=2\nsub1\nsub2"))
+		case "2":
+			if hits[page] == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(";;Entries: 2/4\nsub3\nsub4"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 0, 0, false)
+	client.Retry = fastRetry
+
+	var results []string
+	if err := client.Query(context.Background(), ModeSubs, "example.com", collect(&results)); err != nil {
+		t.Fatalf("QuerySubdomains failed: %v", err)
+	}
+
+	if hits[""] != 1 {
+		t.Errorf("first page should be fetched once, got %d", hits[""])
+	}
+	if hits["2"] != 2 {
+		t.Errorf("failed page should be fetched twice, got %d", hits["2"])
+	}
+	if len(results) != 4 {
+		t.Errorf("expected 4 results without duplicates, got %v", results)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 5, BaseWait: 100 * time.Millisecond, MaxWait: time.Second}
+
+	for attempt := 0; attempt < 6; attempt++ {
+		full := 100 * time.Millisecond << attempt
+		if full > time.Second {
+			full = time.Second
+		}
+		wait := policy.Backoff(attempt, errors.New("boom"))
+		if wait < full/2 || wait >= full {
+			t.Errorf("attempt %d: wait %v outside jitter range [%v, %v)", attempt, wait, full/2, full)
+		}
+	}
+}
+
+func TestRetryPolicy_HonorsRetryAfter(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 3, BaseWait: time.Millisecond, MaxWait: 10 * time.Second}
+
+	err := &StatusError{StatusCode: 429, Status: "429 Too Many Requests", RetryAfter: 2 * time.Second}
+	if wait := policy.Backoff(0, err); wait != 2*time.Second {
+		t.Errorf("Backoff = %v, want Retry-After of 2s", wait)
+	}
+
+	err.RetryAfter = time.Minute
+	if wait := policy.Backoff(0, err); wait != 10*time.Second {
+		t.Errorf("Backoff = %v, want Retry-After capped at 10s", wait)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"-1", 0},
+		{"garbage", 0},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0}, // in the past
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := parseRetryAfter(tt.input); got != tt.expected {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(future); got < 59*time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %v, want ~1h", future, got)
+	}
+}
@@ -0,0 +1,243 @@
+package ipthc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writePEM writes a PEM block to a file in dir and returns its path
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTLSServer starts an httptest TLS server and writes its certificate to a CA bundle
+func newTLSServer(t *testing.T, handler http.Handler) (*httptest.Server, string) {
+	t.Helper()
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+	ca := writePEM(t, t.TempDir(), "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	return server, ca
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(";;Entries: 1/1\none.one.one.one"))
+	})
+}
+
+func TestNewHTTPClient_CustomCA(t *testing.T) {
+	server, ca := newTLSServer(t, okHandler())
+
+	httpClient, err := NewHTTPClient(TransportConfig{CACert: ca})
+	if err != nil {
+		t.Fatalf("NewHTTPClient failed: %v", err)
+	}
+
+	client := NewClient(server.URL, 0, 0, false)
+	client.HTTPClient = httpClient
+
+	var results []string
+	if err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(&results)); err != nil {
+		t.Fatalf("QueryDNS with custom CA failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("unexpected results: %v", results)
+	}
+}
+
+func TestNewHTTPClient_UntrustedServerFails(t *testing.T) {
+	var handshakes atomic.Int32
+	server := httptest.NewUnstartedServer(okHandler())
+	server.TLS = &tls.Config{GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		handshakes.Add(1)
+		return nil, nil
+	}}
+	server.StartTLS()
+	defer server.Close()
+
+	httpClient, _ := NewHTTPClient(TransportConfig{})
+	client := NewClient(server.URL, 0, 0, false)
+	client.HTTPClient = httpClient
+	client.Retry = fastRetry
+
+	err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(new([]string)))
+	if err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("expected certificate error, got %v", err)
+	}
+	if !errors.Is(err, ErrNetwork) {
+		t.Errorf("certificate error should match ErrNetwork, got %v", err)
+	}
+	// A bad certificate is permanent, so the request is not retried
+	if n := handshakes.Load(); n != 1 {
+		t.Errorf("expected 1 TLS handshake, got %d", n)
+	}
+}
+
+func TestNewHTTPClient_Insecure(t *testing.T) {
+	server, _ := newTLSServer(t, okHandler())
+
+	httpClient, _ := NewHTTPClient(TransportConfig{Insecure: true})
+	client := NewClient(server.URL, 0, 0, false)
+	client.HTTPClient = httpClient
+
+	if err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(new([]string))); err != nil {
+		t.Errorf("insecure mode should skip verification, got %v", err)
+	}
+}
+
+func TestNewHTTPClient_ClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+
+	// Self-signed client certificate
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ipthc-test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := writePEM(t, dir, "client.pem", "CERTIFICATE", der)
+	keyFile := writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", keyDER)
+
+	clientCert, _ := x509.ParseCertificate(der)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(okHandler())
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	ca := writePEM(t, dir, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	// Without a client certificate the handshake is rejected
+	httpClient, _ := NewHTTPClient(TransportConfig{CACert: ca})
+	client := NewClient(server.URL, 0, 0, false)
+	client.HTTPClient = httpClient
+	client.Retry = fastRetry
+	if err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(new([]string))); err == nil {
+		t.Error("expected handshake failure without client certificate")
+	}
+
+	httpClient, err = NewHTTPClient(TransportConfig{CACert: ca, ClientCert: certFile, ClientKey: keyFile})
+	if err != nil {
+		t.Fatalf("NewHTTPClient failed: %v", err)
+	}
+	client.HTTPClient = httpClient
+	if err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(new([]string))); err != nil {
+		t.Errorf("QueryDNS with client certificate failed: %v", err)
+	}
+}
+
+func TestNewHTTPClient_Proxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute target URL
+		proxied = append(proxied, r.URL.String())
+		w.Write([]byte(";;Entries: 1/1\nvia.proxy.example"))
+	}))
+	defer proxy.Close()
+
+	httpClient, err := NewHTTPClient(TransportConfig{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatalf("NewHTTPClient failed: %v", err)
+	}
+
+	client := NewClient("http://ipthc.mirror.invalid", 0, 0, false)
+	client.HTTPClient = httpClient
+
+	var results []string
+	if err := client.Query(context.Background(), ModeDNS, "1.1.1.1", collect(&results)); err != nil {
+		t.Fatalf("QueryDNS through proxy failed: %v", err)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://ipthc.mirror.invalid/1.1.1.1" {
+		t.Errorf("proxy saw %v", proxied)
+	}
+	if len(results) != 1 || results[0] != "via.proxy.example" {
+		t.Errorf("unexpected results: %v", results)
+	}
+}
+
+func TestNewHTTPClient_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  TransportConfig
+	}{
+		{"bad proxy scheme", TransportConfig{Proxy: "ftp://proxy:21"}},
+		{"proxy without host", TransportConfig{Proxy: "socks5://"}},
+		{"missing CA file", TransportConfig{CACert: "/nonexistent/ca.pem"}},
+		{"cert without key", TransportConfig{ClientCert: "client.pem"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewHTTPClient(tt.cfg); err == nil {
+				t.Errorf("expected error for %+v", tt.cfg)
+			}
+		})
+	}
+
+	// SOCKS5 proxies are accepted
+	if _, err := NewHTTPClient(TransportConfig{Proxy: "socks5://127.0.0.1:1080"}); err != nil {
+		t.Errorf("socks5 proxy should be accepted: %v", err)
+	}
+}
+
+func TestValidateBaseURL(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		valid    bool
+	}{
+		{"https://ip.thc.org", "https://ip.thc.org", true},
+		{"http://mirror.internal:8080/", "http://mirror.internal:8080", true},
+		{"ftp://ip.thc.org", "", false},
+		{"ip.thc.org", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ValidateBaseURL(tt.input)
+			if tt.valid && (err != nil || got != tt.expected) {
+				t.Errorf("ValidateBaseURL(%q) = %q, %v; want %q", tt.input, got, err, tt.expected)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("ValidateBaseURL(%q) should fail", tt.input)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package ipthc
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// SanitizeInput trims whitespace from input
+func SanitizeInput(input string) string {
+	return strings.TrimSpace(input)
+}
+
+// ValidateIP validates that the input is a valid IPv4 or IPv6 address
+func ValidateIP(input string) error {
+	ip := net.ParseIP(input)
+	if ip == nil {
+		return &InputError{Input: input, Reason: fmt.Sprintf("invalid IP address: %s", input)}
+	}
+	return nil
+}
+
+// ValidateInput validates an input for the given mode: an IP address for
+// dns, a domain for subs and cname
+func ValidateInput(mode, input string) error {
+	switch mode {
+	case ModeDNS:
+		return ValidateIP(input)
+	case ModeSubs, ModeCNAME:
+		return ValidateDomain(input)
+	default:
+		return &InputError{Input: mode, Reason: fmt.Sprintf("unknown mode: %s", mode)}
+	}
+}
+
+// ValidateDomain validates that the input is a valid domain name
+func ValidateDomain(input string) error {
+	if input == "" {
+		return &InputError{Input: input, Reason: "domain cannot be empty"}
+	}
+
+	// Must contain at least one dot (TLD required)
+	if !strings.Contains(input, ".") {
+		return &InputError{Input: input, Reason: "invalid domain: must contain TLD"}
+	}
+
+	// Cannot start or end with dot
+	if strings.HasPrefix(input, ".") || strings.HasSuffix(input, ".") {
+		return &InputError{Input: input, Reason: "invalid domain: cannot start or end with dot"}
+	}
+
+	// Cannot contain double dots
+	if strings.Contains(input, "..") {
+		return &InputError{Input: input, Reason: "invalid domain: cannot contain consecutive dots"}
+	}
+
+	// Cannot contain spaces
+	if strings.Contains(input, " ") {
+		return &InputError{Input: input, Reason: "invalid domain: cannot contain spaces"}
+	}
+
+	// Cannot contain characters that would change the request URL
+	if strings.ContainsAny(input, "/?#%\\") {
+		return &InputError{Input: input, Reason: "invalid domain: cannot contain /, ?, #, % or \\"}
+	}
+
+	return nil
+}
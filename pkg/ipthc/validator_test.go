@@ -1,4 +1,4 @@
-package main
+package ipthc
 
 import (
 	"testing"
@@ -47,6 +47,10 @@ func TestValidateDomain(t *testing.T) {
 		{"example.", false},
 		{"ex ample.com", false},      // space
 		{"example..com", false},      // double dot
+		{"example.com/admin", false},
+		{"example.com?page=2", false},
+		{"example.com#x", false},
+		{"example.com%2f", false},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,106 @@
+package main
+
+import "sync"
+
+// Job is a single query to run
+type Job struct {
+	Input string // Address or domain to query
+	Mode  string // Query mode to run
+	Range string // Parent CIDR block or dash range Input was expanded from, if any
+	Depth int    // Recursion depth (0 for inputs read from stdin)
+	From  string // Input whose results this job was derived from, if any
+}
+
+// WorkerPool fans jobs out to a fixed number of goroutines
+type WorkerPool struct {
+	Workers int
+	Handle  func(job Job)
+}
+
+// NewWorkerPool creates a worker pool that runs handle on each job
+// Worker counts below 1 are treated as 1
+func NewWorkerPool(workers int, handle func(job Job)) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &WorkerPool{Workers: workers, Handle: handle}
+}
+
+// Run processes jobs until the channel is closed and all workers are done
+func (p *WorkerPool) Run(jobs <-chan Job) {
+	var wg sync.WaitGroup
+	for i := 0; i < p.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				p.Handle(job)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// JobQueue is an unbounded FIFO for jobs derived inside workers. Push never
+// blocks, and a single Drain goroutine feeds the queued jobs to the pool, so
+// a large fan-out costs one Job each rather than one parked goroutine each.
+type JobQueue struct {
+	mu    sync.Mutex
+	jobs  []Job
+	ready chan struct{} // Signalled when jobs becomes non-empty
+}
+
+// NewJobQueue creates an empty job queue
+func NewJobQueue() *JobQueue {
+	return &JobQueue{ready: make(chan struct{}, 1)}
+}
+
+// Push queues a job without blocking
+func (q *JobQueue) Push(job Job) {
+	q.mu.Lock()
+	q.jobs = append(q.jobs, job)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of jobs waiting to be drained
+func (q *JobQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs)
+}
+
+// Drain sends queued jobs to out in order until Close is called
+func (q *JobQueue) Drain(out chan<- Job) {
+	for range q.ready {
+		for {
+			job, ok := q.pop()
+			if !ok {
+				break
+			}
+			out <- job
+		}
+	}
+}
+
+func (q *JobQueue) pop() (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.jobs) == 0 {
+		return Job{}, false
+	}
+	job := q.jobs[0]
+	q.jobs[0] = Job{}
+	q.jobs = q.jobs[1:]
+	return job, true
+}
+
+// Close stops Drain once the queue is empty
+// No jobs may be pushed after Close
+func (q *JobQueue) Close() {
+	close(q.ready)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestWorkerPool_ProcessesAllInputs(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+
+	pool := NewWorkerPool(8, func(job Job) {
+		mu.Lock()
+		seen[job.Input] = true
+		mu.Unlock()
+	})
+
+	jobs := make(chan Job)
+	go func() {
+		for i := 0; i < 100; i++ {
+			jobs <- Job{Input: fmt.Sprintf("input-%d", i)}
+		}
+		close(jobs)
+	}()
+	pool.Run(jobs)
+
+	if len(seen) != 100 {
+		t.Errorf("expected 100 inputs processed, got %d", len(seen))
+	}
+}
+
+func TestNewWorkerPool_MinimumOneWorker(t *testing.T) {
+	pool := NewWorkerPool(0, func(Job) {})
+	if pool.Workers != 1 {
+		t.Errorf("Workers = %d, want 1", pool.Workers)
+	}
+}
+
+func TestJobQueue_BuffersWithoutBlockingInOrder(t *testing.T) {
+	q := NewJobQueue()
+
+	// Nothing is draining yet, so Push must not block
+	for i := 0; i < 10000; i++ {
+		q.Push(Job{Input: fmt.Sprintf("input-%d", i)})
+	}
+	if q.Len() != 10000 {
+		t.Fatalf("Len() = %d, want 10000", q.Len())
+	}
+
+	out := make(chan Job)
+	drained := make(chan struct{})
+	go func() {
+		q.Drain(out)
+		close(drained)
+	}()
+
+	for i := 0; i < 10000; i++ {
+		if job := <-out; job.Input != fmt.Sprintf("input-%d", i) {
+			t.Fatalf("job %d = %s, want input-%d", i, job.Input, i)
+		}
+	}
+
+	q.Push(Job{Input: "late"})
+	if job := <-out; job.Input != "late" {
+		t.Errorf("job pushed while draining = %s, want late", job.Input)
+	}
+
+	q.Close()
+	<-drained
+}
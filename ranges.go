@@ -0,0 +1,105 @@
+package main
+
+import (
+	"iter"
+	"math/big"
+	"net/netip"
+	"strings"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+const defaultMaxRange = 65536 // a /16 worth of IPv4 addresses
+
+// IPRange is an inclusive range of IP addresses from a CIDR block or a dash range
+type IPRange struct {
+	First netip.Addr
+	Last  netip.Addr
+}
+
+// IsIPRange reports whether input looks like a CIDR block or a dash range
+// rather than a single address
+func IsIPRange(input string) bool {
+	return strings.ContainsAny(input, "/-")
+}
+
+// ParseIPRange parses a CIDR block (10.0.0.0/24, 2001:db8::/120) or a dash
+// range (1.2.3.4-1.2.3.40)
+func ParseIPRange(input string) (IPRange, error) {
+	if strings.Contains(input, "/") {
+		prefix, err := netip.ParsePrefix(input)
+		if err != nil {
+			return IPRange{}, &ipthc.InputError{Input: input, Reason: "invalid CIDR block: " + input}
+		}
+		prefix = prefix.Masked()
+		return IPRange{First: prefix.Addr(), Last: lastAddr(prefix)}, nil
+	}
+
+	start, end, ok := strings.Cut(input, "-")
+	if !ok {
+		return IPRange{}, &ipthc.InputError{Input: input, Reason: "invalid IP range: " + input}
+	}
+
+	first, err := netip.ParseAddr(strings.TrimSpace(start))
+	if err != nil {
+		return IPRange{}, &ipthc.InputError{Input: input, Reason: "invalid IP range start: " + input}
+	}
+	last, err := netip.ParseAddr(strings.TrimSpace(end))
+	if err != nil {
+		return IPRange{}, &ipthc.InputError{Input: input, Reason: "invalid IP range end: " + input}
+	}
+
+	if first.Is4() != last.Is4() {
+		return IPRange{}, &ipthc.InputError{Input: input, Reason: "invalid IP range: mixed IPv4 and IPv6: " + input}
+	}
+	if last.Less(first) {
+		return IPRange{}, &ipthc.InputError{Input: input, Reason: "invalid IP range: start is after end: " + input}
+	}
+
+	return IPRange{First: first, Last: last}, nil
+}
+
+// lastAddr returns the highest address inside a masked prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	bits := prefix.Bits()
+	for i := range b {
+		for j := 0; j < 8; j++ {
+			if i*8+j >= bits {
+				b[i] |= 0x80 >> j
+			}
+		}
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// Size returns the number of addresses in the range
+func (r IPRange) Size() *big.Int {
+	first := new(big.Int).SetBytes(r.First.AsSlice())
+	last := new(big.Int).SetBytes(r.Last.AsSlice())
+	size := last.Sub(last, first)
+	return size.Add(size, big.NewInt(1))
+}
+
+// Exceeds reports whether the range holds more than max addresses
+func (r IPRange) Exceeds(max int) bool {
+	return r.Size().Cmp(big.NewInt(int64(max))) > 0
+}
+
+// All lazily yields every address in the range in order
+func (r IPRange) All() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		for addr := r.First; addr.IsValid(); addr = addr.Next() {
+			if !yield(addr) || addr == r.Last {
+				return
+			}
+		}
+	}
+}
+
+// Contains reports whether addr falls inside the range
+func (r IPRange) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.Is4() == r.First.Is4() && !addr.Less(r.First) && !r.Last.Less(addr)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestParseIPRange(t *testing.T) {
+	tests := []struct {
+		input string
+		first string
+		last  string
+		size  string
+	}{
+		{"10.0.0.0/24", "10.0.0.0", "10.0.0.255", "256"},
+		{"10.0.0.77/30", "10.0.0.76", "10.0.0.79", "4"},
+		{"192.168.1.1/32", "192.168.1.1", "192.168.1.1", "1"},
+		{"2001:db8::/126", "2001:db8::", "2001:db8::3", "4"},
+		{"2001:db8::/64", "2001:db8::", "2001:db8::ffff:ffff:ffff:ffff", "18446744073709551616"},
+		{"1.2.3.4-1.2.3.40", "1.2.3.4", "1.2.3.40", "37"},
+		{"1.2.3.250-1.2.4.5", "1.2.3.250", "1.2.4.5", "12"},
+		{"2001:db8::1-2001:db8::a", "2001:db8::1", "2001:db8::a", "10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			r, err := ParseIPRange(tt.input)
+			if err != nil {
+				t.Fatalf("ParseIPRange(%q) failed: %v", tt.input, err)
+			}
+			if r.First.String() != tt.first {
+				t.Errorf("First = %s, want %s", r.First, tt.first)
+			}
+			if r.Last.String() != tt.last {
+				t.Errorf("Last = %s, want %s", r.Last, tt.last)
+			}
+			if r.Size().String() != tt.size {
+				t.Errorf("Size = %s, want %s", r.Size(), tt.size)
+			}
+		})
+	}
+}
+
+func TestParseIPRange_Invalid(t *testing.T) {
+	tests := []string{
+		"10.0.0.0/33",
+		"not.an.ip/24",
+		"1.2.3.40-1.2.3.4",   // reversed
+		"1.2.3.4-2001:db8::", // mixed families
+		"1.2.3.4-",
+		"-1.2.3.4",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			if _, err := ParseIPRange(input); err == nil {
+				t.Errorf("ParseIPRange(%q) should fail", input)
+			}
+		})
+	}
+}
+
+func TestIPRange_All(t *testing.T) {
+	r, _ := ParseIPRange("1.2.3.254-1.2.4.1")
+
+	var got []string
+	for addr := range r.All() {
+		got = append(got, addr.String())
+	}
+
+	expected := []string{"1.2.3.254", "1.2.3.255", "1.2.4.0", "1.2.4.1"}
+	if len(got) != len(expected) {
+		t.Fatalf("got %v, want %v", got, expected)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("addr[%d] = %s, want %s", i, got[i], expected[i])
+		}
+	}
+}
+
+func TestIPRange_AllStopsEarly(t *testing.T) {
+	// A huge range must not be materialized when the consumer stops
+	r, _ := ParseIPRange("2001:db8::/32")
+
+	count := 0
+	for range r.All() {
+		count++
+		if count == 3 {
+			break
+		}
+	}
+
+	if count != 3 {
+		t.Errorf("expected to stop after 3 addresses, got %d", count)
+	}
+}
+
+func TestIPRange_AllLastAddress(t *testing.T) {
+	r, _ := ParseIPRange("255.255.255.254/31")
+
+	count := 0
+	for range r.All() {
+		count++
+	}
+
+	if count != 2 {
+		t.Errorf("expected 2 addresses at the top of the address space, got %d", count)
+	}
+}
+
+func TestIPRange_Exceeds(t *testing.T) {
+	r, _ := ParseIPRange("10.0.0.0/24")
+
+	if r.Exceeds(256) {
+		t.Error("/24 should not exceed 256")
+	}
+	if !r.Exceeds(255) {
+		t.Error("/24 should exceed 255")
+	}
+}
+
+func TestIsIPRange(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"10.0.0.0/24", true},
+		{"1.2.3.4-1.2.3.40", true},
+		{"1.2.3.4", false},
+		{"2606:4700:4700::1111", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsIPRange(tt.input); got != tt.expected {
+			t.Errorf("IsIPRange(%q) = %v, want %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestIPRange_Contains(t *testing.T) {
+	r, _ := ParseIPRange("10.0.0.0/24")
+
+	tests := []struct {
+		addr     string
+		expected bool
+	}{
+		{"10.0.0.0", true},
+		{"10.0.0.255", true},
+		{"10.0.1.0", false},
+		{"9.255.255.255", false},
+		{"::ffff:10.0.0.7", true},
+		{"2001:db8::1", false},
+	}
+
+	for _, tt := range tests {
+		if got := r.Contains(netip.MustParseAddr(tt.addr)); got != tt.expected {
+			t.Errorf("Contains(%s) = %v, want %v", tt.addr, got, tt.expected)
+		}
+	}
+}
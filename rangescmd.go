@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+// rangeSource is where a provider publishes its IP ranges
+type rangeSource struct {
+	File string         // Name of the file in the ranges directory
+	URL  string         // Download URL, or a page linking to it when Link is set
+	Link *regexp.Regexp // Finds the real download URL on the page at URL
+}
+
+// rangeSources are fetched by `ipthc ranges update`
+// Akamai publishes no stable machine-readable list; drop its CIDRs into akamai.txt
+var rangeSources = []rangeSource{
+	{File: "aws.json", URL: "https://ip-ranges.amazonaws.com/ip-ranges.json"},
+	{File: "gcp.json", URL: "https://www.gstatic.com/ipranges/cloud.json"},
+	{
+		File: "azure.json",
+		URL:  "https://www.microsoft.com/en-us/download/details.aspx?id=56519",
+		Link: regexp.MustCompile(`https://download\.microsoft\.com/download/[^"'\s]+/ServiceTags_Public_\d+\.json`),
+	},
+	{File: "cloudflare.json", URL: "https://api.cloudflare.com/client/v4/ips"},
+}
+
+// maxRangeFileSize bounds a downloaded range file (Azure's is ~4 MB)
+const maxRangeFileSize = 64 << 20
+
+// runRangesCommand implements the `ipthc ranges` subcommands and returns the exit code
+func runRangesCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "update" {
+		fmt.Fprintln(stderr, "Usage: ipthc ranges update [-dir <dir>] [-proxy <url>]")
+		return 1
+	}
+
+	fs := flag.NewFlagSet("ranges update", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", DefaultRangesDir(), "Directory to store provider range files in")
+	proxy := fs.String("proxy", envOr("IPTHC_PROXY", ""), "HTTP(S) or SOCKS5 proxy URL (env IPTHC_PROXY, falls back to HTTP(S)_PROXY)")
+	timeout := fs.Duration("timeout", 60*time.Second, "Timeout for each download")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return 1
+	}
+
+	client, err := ipthc.NewHTTPClient(ipthc.TransportConfig{Proxy: *proxy})
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	client.Timeout = *timeout
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		fmt.Fprintf(stderr, "Error: failed to create ranges directory: %v\n", err)
+		return 1
+	}
+
+	failed := 0
+	for _, src := range rangeSources {
+		if err := updateRangeFile(client, *dir, src); err != nil {
+			fmt.Fprintf(stderr, "Error updating %s: %v\n", src.File, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(stdout, "Updated %s\n", filepath.Join(*dir, src.File))
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// updateRangeFile downloads one source, checks that it parses and replaces
+// the file atomically so a failed download never clobbers a good copy
+func updateRangeFile(client *http.Client, dir string, src rangeSource) error {
+	url := src.URL
+	if src.Link != nil {
+		page, err := download(client, url)
+		if err != nil {
+			return err
+		}
+		link := src.Link.Find(page)
+		if link == nil {
+			return fmt.Errorf("no download link found at %s", url)
+		}
+		url = string(link)
+	}
+
+	data, err := download(client, url)
+	if err != nil {
+		return err
+	}
+	if err := rangeParsers[src.File](NewCloudRanges(), data); err != nil {
+		return fmt.Errorf("invalid data from %s: %w", url, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, src.File)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// download fetches url, failing on non-200 responses
+func download(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: HTTP %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxRangeFileSize))
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+// Runner turns input lines into query jobs, runs them on a worker pool and
+// writes their results
+type Runner struct {
+	Client   *ipthc.Client
+	Out      ResultWriter
+	Logger   *ErrorLogger
+	State    *StateJournal // nil disables resumable runs
+	Diff     *DiffWriter   // Told about completed queries when diffing (nil disables)
+	Scope    *Scope        // Results outside it are dropped and not pivoted on (nil keeps all)
+	Rejected ResultWriter  // Receives out-of-scope results (nil discards them)
+	Modes    []string      // Query modes to run for each input
+	MaxRange int           // Maximum addresses a CIDR block or IP range may expand to
+	MaxDepth int           // How many times results are fed back as new queries (0 disables)
+	Verbose  bool
+
+	seen    sync.Map       // mode+input of every job queued while recursing
+	pending sync.WaitGroup // Jobs queued but not yet processed
+	enqueue func(Job)      // Queues a derived job without blocking the worker
+
+	failures       atomic.Int64
+	byClass        [numFailureClasses]atomic.Int64
+	truncated      atomic.Int64
+	mismatched     atomic.Int64
+	unclassified   atomic.Int64
+	outOfScope     atomic.Int64
+	quotaExhausted atomic.Bool
+}
+
+// Failures returns the number of inputs that failed validation or querying
+func (r *Runner) Failures() int64 {
+	return r.failures.Load()
+}
+
+// FailuresByClass returns the number of failures in each FailureClass
+func (r *Runner) FailuresByClass() [numFailureClasses]int64 {
+	var counts [numFailureClasses]int64
+	for c := range counts {
+		counts[c] = r.byClass[c].Load()
+	}
+	return counts
+}
+
+// WorstFailure returns the most severe class with at least one failure, and
+// false if nothing failed
+func (r *Runner) WorstFailure() (FailureClass, bool) {
+	for c := numFailureClasses - 1; c >= 0; c-- {
+		if r.byClass[c].Load() > 0 {
+			return c, true
+		}
+	}
+	return FailureOther, false
+}
+
+// Truncated returns the number of queries cut off by the client's page cap
+func (r *Runner) Truncated() int64 {
+	return r.truncated.Load()
+}
+
+// Mismatched returns the number of queries whose fetched results did not add
+// up to the total the API advertised
+func (r *Runner) Mismatched() int64 {
+	return r.mismatched.Load()
+}
+
+// Unclassified returns the number of inputs that matched none of the selected
+// modes when routing by input kind; these are not counted as failures
+func (r *Runner) Unclassified() int64 {
+	return r.unclassified.Load()
+}
+
+// OutOfScope returns the number of results dropped by Scope
+func (r *Runner) OutOfScope() int64 {
+	return r.outOfScope.Load()
+}
+
+// Run reads input lines from in and processes them with the given number of workers
+// When recursing, the run only ends once every derived job has been processed too
+// Cancelling ctx stops reading input and abandons queued jobs; Run then returns
+// ctx.Err() once in-flight queries have wound down
+func (r *Runner) Run(ctx context.Context, in io.Reader, workers int) error {
+	jobs := make(chan Job)
+	pool := NewWorkerPool(workers, func(job Job) {
+		defer r.pending.Done()
+		r.Process(ctx, job)
+	})
+	done := make(chan struct{})
+	go func() {
+		pool.Run(jobs)
+		close(done)
+	}()
+
+	emit := func(job Job) bool {
+		if r.quotaExhausted.Load() || ctx.Err() != nil {
+			return false
+		}
+		if !r.firstSeen(job) {
+			return true
+		}
+		r.pending.Add(1)
+		jobs <- job
+		return true
+	}
+
+	// Derived jobs are queued from inside workers, so park them in a queue
+	// rather than blocking on a channel the workers must drain
+	derived := NewJobQueue()
+	drained := make(chan struct{})
+	go func() {
+		derived.Drain(jobs)
+		close(drained)
+	}()
+	r.enqueue = func(job Job) {
+		if r.quotaExhausted.Load() || !r.firstSeen(job) {
+			return
+		}
+		if r.State != nil {
+			if err := r.State.Queue(job); err != nil {
+				r.Logger.Log(job.Mode, job.Input, err.Error())
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+		r.pending.Add(1)
+		derived.Push(job)
+	}
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		input := ipthc.SanitizeInput(scanner.Text())
+
+		// Skip empty lines and comments
+		if input == "" || input[0] == '#' {
+			continue
+		}
+
+		if r.quotaExhausted.Load() || ctx.Err() != nil {
+			break
+		}
+
+		r.Dispatch(input, emit)
+	}
+
+	// A resumed run picks up the derived jobs an earlier run queued but did
+	// not finish; their seeds are done and will not pivot again
+	if r.State != nil && ctx.Err() == nil {
+		for _, job := range r.State.Derived() {
+			if job.Depth <= r.MaxDepth {
+				r.enqueue(job)
+			}
+		}
+	}
+
+	r.pending.Wait()
+	derived.Close()
+	<-drained
+	close(jobs)
+	<-done
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return scanner.Err()
+}
+
+// firstSeen reports whether job has not been queued before
+// Deduplication only applies when recursing; otherwise every input is queried
+func (r *Runner) firstSeen(job Job) bool {
+	if r.MaxDepth <= 0 {
+		return true
+	}
+	_, loaded := r.seen.LoadOrStore(job.Mode+" "+job.Input, true)
+	return !loaded
+}
+
+// Dispatch turns one input line into jobs for every applicable mode
+// emit returns false once no more jobs should be queued
+func (r *Runner) Dispatch(input string, emit func(Job) bool) {
+	// With a single mode every input goes to that mode and is validated there
+	if len(r.Modes) == 1 {
+		mode := r.Modes[0]
+		if mode == ipthc.ModeDNS && IsIPRange(input) {
+			r.expandRange(mode, input, emit)
+			return
+		}
+		emit(Job{Input: input, Mode: mode})
+		return
+	}
+
+	// With several modes each input is routed by what it looks like
+	kind := Classify(input)
+	matched := false
+	for _, mode := range r.Modes {
+		if !ModeAccepts(mode, kind) {
+			continue
+		}
+		matched = true
+
+		if kind == KindRange {
+			if !r.expandRange(mode, input, emit) {
+				return
+			}
+			continue
+		}
+		if !emit(Job{Input: input, Mode: mode}) {
+			return
+		}
+	}
+
+	if !matched {
+		r.unclassified.Add(1)
+		r.Logger.Log("unclassified", input, fmt.Sprintf("not a valid input for modes %s", strings.Join(r.Modes, ",")))
+		if r.Verbose {
+			fmt.Fprintf(os.Stderr, "Skipping unclassifiable input: %s\n", input)
+		}
+	}
+}
+
+// expandRange lazily queues one job per address in a CIDR block or dash range
+// Returns false if emit asked to stop
+func (r *Runner) expandRange(mode, input string, emit func(Job) bool) bool {
+	ipRange, err := ParseIPRange(input)
+	if err == nil && ipRange.Exceeds(r.MaxRange) {
+		err = &ipthc.InputError{Input: input, Reason: fmt.Sprintf("range too large: %s addresses (max %d, see -max-range)", ipRange.Size(), r.MaxRange)}
+	}
+	if err != nil {
+		r.fail(mode, input, err)
+		return true
+	}
+
+	for addr := range ipRange.All() {
+		if !emit(Job{Input: addr.String(), Mode: mode, Range: input}) {
+			return false
+		}
+	}
+	return true
+}
+
+// Process validates and queries a single job
+func (r *Runner) Process(ctx context.Context, job Job) {
+	// Once the quota is gone or the run is cancelled, drain remaining jobs
+	// without querying
+	if r.quotaExhausted.Load() || ctx.Err() != nil {
+		return
+	}
+
+	mode, input := job.Mode, job.Input
+
+	// Skip queries a previous run already finished
+	if r.State != nil && r.State.Done(mode, input) {
+		if r.Verbose {
+			fmt.Fprintf(os.Stderr, "Skipping %s %s (already completed)\n", mode, input)
+		}
+		return
+	}
+
+	err := ipthc.ValidateInput(mode, input)
+	if err != nil {
+		r.fail(mode, input, err)
+		return
+	}
+
+	var from *ipthc.Checkpoint
+	if r.State != nil {
+		checkpoint := func(cp ipthc.Checkpoint) error {
+			return r.State.Record(mode, input, cp)
+		}
+		from = r.State.Checkpoint(mode, input)
+		err = r.Client.QueryFrom(ctx, mode, input, from, r.callback(job), checkpoint)
+	} else {
+		err = r.Client.Query(ctx, mode, input, r.callback(job))
+	}
+
+	if err == nil && r.State != nil {
+		err = r.State.MarkDone(mode, input)
+	}
+
+	// A query resumed from a checkpoint only delivered its remaining pages,
+	// so the results it did not return this time are not known to be removed
+	if err == nil && r.Diff != nil && from == nil {
+		r.Diff.Complete(job)
+	}
+
+	// An interrupted query is neither done nor failed; with -state it picks
+	// up from its last checkpoint next time
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+
+	// A truncated query delivered what it could; it is flagged rather than
+	// failed, and left unfinished so a resumed run with a higher cap continues it
+	var truncated *ipthc.TruncatedError
+	if errors.As(err, &truncated) {
+		r.truncate(job, truncated)
+		return
+	}
+
+	if err != nil {
+		if errors.Is(err, ipthc.ErrQuotaExhausted) && !r.quotaExhausted.Swap(true) {
+			fmt.Fprintln(os.Stderr, "API quota exhausted, stopping")
+		}
+		r.countFailure(err)
+		r.Logger.Log(mode, input, err.Error())
+		if r.Verbose {
+			fmt.Fprintf(os.Stderr, "Error querying %s: %v\n", input, err)
+		}
+	}
+}
+
+// callback streams results for one job as they arrive
+// Each result is written atomically so concurrent workers never interleave
+func (r *Runner) callback(job Job) ipthc.PageCallback {
+	return func(results []string, currentPage int, totalResults int) error {
+		var kept []string
+		for _, res := range NewResults(job.Mode, job.Input, results, currentPage, totalResults) {
+			res.Range = job.Range
+			res.Depth = job.Depth
+			res.From = job.From
+
+			out := r.Out
+			if !r.Scope.InScope(res.Result) {
+				r.outOfScope.Add(1)
+				if out = r.Rejected; out == nil {
+					continue
+				}
+			} else {
+				kept = append(kept, res.Result)
+			}
+			if err := out.Write(res); err != nil {
+				return err
+			}
+		}
+
+		if job.Depth < r.MaxDepth {
+			for _, result := range kept {
+				for _, next := range Pivot(job.Mode, result) {
+					next.Depth = job.Depth + 1
+					next.From = job.Input
+					r.enqueue(next)
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// truncate records a query that stopped at the page cap and marks it in the output
+func (r *Runner) truncate(job Job, t *ipthc.TruncatedError) {
+	r.truncated.Add(1)
+	r.Logger.Log(job.Mode, job.Input, t.Error())
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "Warning: %s %s %v\n", job.Mode, job.Input, t)
+	}
+
+	marker := Result{
+		Input:     job.Input,
+		Mode:      job.Mode,
+		Total:     t.Total,
+		Timestamp: time.Now().Unix(),
+		Range:     job.Range,
+		Depth:     job.Depth,
+		From:      job.From,
+		Truncated: &Truncation{Pages: t.Pages, Fetched: t.Fetched, Total: t.Total},
+	}
+	if err := r.Out.Write(marker); err != nil {
+		r.fail(job.Mode, job.Input, err)
+	}
+}
+
+// Warn logs a problem that did not fail a query, such as a result count
+// that does not add up; install it as the client's Warn
+func (r *Runner) Warn(mode, input string, warning error) {
+	if errors.Is(warning, ipthc.ErrCountMismatch) {
+		r.mismatched.Add(1)
+	}
+	r.Logger.Log(mode, input, "warning: "+warning.Error())
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "Warning: %s %s %v\n", mode, input, warning)
+	}
+}
+
+// fail records an input that could not be queried
+func (r *Runner) fail(mode, input string, err error) {
+	r.countFailure(err)
+	r.Logger.Log(mode, input, err.Error())
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+}
+
+// countFailure counts a failure in total and under its class
+func (r *Runner) countFailure(err error) {
+	r.failures.Add(1)
+	r.byClass[classifyFailure(err)].Add(1)
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+	"github.com/DFC302/ipthc/pkg/ipthc/ipthctest"
+)
+
+// modeServer answers every endpoint with one result naming the endpoint
+func modeServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/")
+		w.Write([]byte(";;Entries: 1/1\nresult-for-" + strings.ReplaceAll(path, "/", "-")))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestRunner builds a runner against server writing text output to buf
+func newTestRunner(t *testing.T, server *httptest.Server, modes []string, buf *bytes.Buffer) *Runner {
+	t.Helper()
+	logger, err := NewErrorLogger(filepath.Join(t.TempDir(), "errors.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { logger.Close() })
+
+	out, _ := NewResultWriter(FormatText, buf, len(modes) > 1)
+	runner := &Runner{
+		Client:   ipthc.NewClient(server.URL, 0, 0, false),
+		Out:      out,
+		Logger:   logger,
+		Modes:    modes,
+		MaxRange: defaultMaxRange,
+	}
+	runner.Client.Warn = runner.Warn
+	return runner
+}
+
+func sortedLines(s string) []string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestRunner_AllModesRoutesByInputKind(t *testing.T) {
+	var buf bytes.Buffer
+	runner := newTestRunner(t, modeServer(t), AllModes, &buf)
+
+	input := "1.1.1.1\nexample.com\n10.0.0.0/31\n# comment\n\nnot_valid\n"
+	if err := runner.Run(context.Background(), strings.NewReader(input), 4); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	expected := []string{
+		"cname\tresult-for-cn-example.com",
+		"dns\tresult-for-1.1.1.1",
+		"dns\tresult-for-10.0.0.0",
+		"dns\tresult-for-10.0.0.1",
+		"subs\tresult-for-sb-example.com",
+	}
+	got := sortedLines(buf.String())
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("output =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+
+	// The line that fits no mode is reported separately from failures
+	if runner.Failures() != 0 {
+		t.Errorf("Failures() = %d, want 0", runner.Failures())
+	}
+	if runner.Unclassified() != 1 {
+		t.Errorf("Unclassified() = %d, want 1", runner.Unclassified())
+	}
+}
+
+func TestRunner_ModeSubset(t *testing.T) {
+	var buf bytes.Buffer
+	runner := newTestRunner(t, modeServer(t), []string{ipthc.ModeSubs, ipthc.ModeCNAME}, &buf)
+
+	// An IP fits neither subs nor cname
+	runner.Run(context.Background(), strings.NewReader("example.com\n1.1.1.1\n"), 1)
+
+	got := sortedLines(buf.String())
+	if len(got) != 2 || got[0] != "cname\tresult-for-cn-example.com" || got[1] != "subs\tresult-for-sb-example.com" {
+		t.Errorf("unexpected output: %v", got)
+	}
+	if runner.Unclassified() != 1 {
+		t.Errorf("Unclassified() = %d, want 1", runner.Unclassified())
+	}
+}
+
+func TestRunner_SingleModeValidates(t *testing.T) {
+	var buf bytes.Buffer
+	runner := newTestRunner(t, modeServer(t), []string{ipthc.ModeDNS}, &buf)
+
+	runner.Run(context.Background(), strings.NewReader("1.1.1.1\nexample.com\n"), 1)
+
+	// Single-mode output is untagged
+	if buf.String() != "result-for-1.1.1.1\n" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+	if runner.Failures() != 1 {
+		t.Errorf("Failures() = %d, want 1", runner.Failures())
+	}
+}
+
+func TestRunner_CountsFailuresByClass(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.1.1.2":
+			w.WriteHeader(http.StatusNotFound)
+		case "/1.1.1.3":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(";;Entries: 1/1\nok"))
+		}
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	runner := newTestRunner(t, server, []string{ipthc.ModeDNS}, &buf)
+	runner.Client.Retry = ipthc.RetryPolicy{}
+
+	input := "1.1.1.1\n1.1.1.2\n1.1.1.3\nnot.an.ip\n10.0.0.0/8\n"
+	runner.Run(context.Background(), strings.NewReader(input), 2)
+
+	var want [numFailureClasses]int64
+	want[FailureInvalidInput] = 2
+	want[FailureRateLimited] = 1
+	want[FailureHTTPStatus] = 1
+	if got := runner.FailuresByClass(); got != want {
+		t.Errorf("FailuresByClass() = %v, want %v", got, want)
+	}
+	if worst, failed := runner.WorstFailure(); !failed || worst != FailureHTTPStatus {
+		t.Errorf("WorstFailure() = %s, %v, want %s", worst, failed, FailureHTTPStatus)
+	}
+	if runner.Failures() != 4 {
+		t.Errorf("Failures() = %d, want 4", runner.Failures())
+	}
+}
+
+func TestRunner_AutoSeparatesUnclassifiedFromFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sb/broken.example.com" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(";;Entries: 1/1\nok"))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	runner := newTestRunner(t, server, AutoModes(false), &buf)
+
+	input := "1.1.1.1\nexample.com\nbroken.example.com\ngarbage\n???\n"
+	runner.Run(context.Background(), strings.NewReader(input), 2)
+
+	if runner.Failures() != 1 {
+		t.Errorf("Failures() = %d, want 1 (the 404)", runner.Failures())
+	}
+	if runner.Unclassified() != 2 {
+		t.Errorf("Unclassified() = %d, want 2", runner.Unclassified())
+	}
+
+	got := sortedLines(buf.String())
+	if len(got) != 2 || got[0] != "dns\tok" || got[1] != "subs\tok" {
+		t.Errorf("unexpected output: %v", got)
+	}
+}
+
+func TestRunner_RecursesWithDepthLimitAndDedup(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/1.1.1.1":
+			w.Write([]byte(";;Entries: 2/2\nwww.example.com\nmail.example.com"))
+		case "/sb/example.com":
+			// Points back at the seed: must not be queried again
+			w.Write([]byte(";;Entries: 2/2\napi.example.com\n1.1.1.1"))
+		default:
+			w.Write([]byte(";;Entries: 0/0"))
+		}
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	runner := newTestRunner(t, server, []string{ipthc.ModeDNS}, &buf)
+	runner.Out, _ = NewResultWriter(FormatText, &buf, true)
+	runner.MaxDepth = 2
+
+	if err := runner.Run(context.Background(), strings.NewReader("1.1.1.1\n"), 4); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// Both reverse-DNS hits share an apex, which is only enumerated once
+	if hits["/sb/example.com"] != 1 {
+		t.Errorf("apex queried %d times, want 1", hits["/sb/example.com"])
+	}
+	if hits["/1.1.1.1"] != 1 {
+		t.Errorf("seed queried %d times, want 1", hits["/1.1.1.1"])
+	}
+	if len(hits) != 2 {
+		t.Errorf("unexpected queries: %v", hits)
+	}
+
+	got := sortedLines(buf.String())
+	expected := []string{"dns\tmail.example.com", "dns\twww.example.com", "subs\t1.1.1.1", "subs\tapi.example.com"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("output = %v, want %v", got, expected)
+	}
+}
+
+func TestRunner_RecursionDepthLimit(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+
+		// Every CNAME lookup returns a new name, forming an endless chain
+		next := "x" + strings.TrimPrefix(r.URL.Path, "/cn/")
+		w.Write([]byte(";;Entries: 1/1\n" + next))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	runner := newTestRunner(t, server, []string{ipthc.ModeCNAME}, &buf)
+	runner.MaxDepth = 3
+
+	runner.Run(context.Background(), strings.NewReader("a.example.com\n"), 2)
+
+	cnames := 0
+	for _, p := range paths {
+		if strings.HasPrefix(p, "/cn/") {
+			cnames++
+		}
+	}
+	if cnames != 4 {
+		t.Errorf("expected seed + 3 levels of cname lookups, got %d: %v", cnames, paths)
+	}
+}
+
+func TestRunner_RecursionNDJSONProvenance(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/1.1.1.1" {
+			w.Write([]byte(";;Entries: 1/1\nwww.example.com"))
+			return
+		}
+		w.Write([]byte(";;Entries: 1/1\napi.example.com"))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	runner := newTestRunner(t, server, []string{ipthc.ModeDNS}, &buf)
+	runner.Out, _ = NewResultWriter(FormatNDJSON, &buf, false)
+	runner.MaxDepth = 1
+
+	runner.Run(context.Background(), strings.NewReader("1.1.1.1\n"), 1)
+
+	var derived Result
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var r Result
+		json.Unmarshal([]byte(line), &r)
+		if r.Mode == ipthc.ModeSubs {
+			derived = r
+		}
+	}
+	if derived.Input != "example.com" || derived.Depth != 1 || derived.From != "1.1.1.1" {
+		t.Errorf("unexpected derived result: %+v", derived)
+	}
+}
+
+func TestRunner_ScopeFiltersResultsAndPivots(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+
+		if r.URL.Path == "/1.1.1.1" {
+			w.Write([]byte(";;Entries: 3/3\nwww.example.com\nmail.example.com\nshop.other.net"))
+			return
+		}
+		w.Write([]byte(";;Entries: 0/0"))
+	}))
+	defer server.Close()
+
+	include := &ScopeList{}
+	include.Add("*.example.com")
+	exclude := &ScopeList{}
+	exclude.Add("mail.example.com")
+
+	var buf, rejected bytes.Buffer
+	runner := newTestRunner(t, server, []string{ipthc.ModeDNS}, &buf)
+	runner.Scope = &Scope{Include: include, Exclude: exclude}
+	runner.Rejected, _ = NewResultWriter(FormatText, &rejected, false)
+	runner.MaxDepth = 1
+
+	if err := runner.Run(context.Background(), strings.NewReader("1.1.1.1\n"), 2); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if got := strings.TrimSpace(buf.String()); got != "www.example.com" {
+		t.Errorf("in-scope output = %q", got)
+	}
+	if got := sortedLines(rejected.String()); !reflect.DeepEqual(got, []string{"mail.example.com", "shop.other.net"}) {
+		t.Errorf("out-of-scope output = %v", got)
+	}
+	if runner.OutOfScope() != 2 {
+		t.Errorf("OutOfScope() = %d, want 2", runner.OutOfScope())
+	}
+
+	// Only the in-scope result is pivoted on
+	if hits["/sb/other.net"] != 0 || hits["/sb/example.com"] != 1 {
+		t.Errorf("unexpected pivots: %v", hits)
+	}
+}
+
+func TestRunner_CancelStopsRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		cancel()
+		w.Write([]byte(";;Entries: 1/1\nok"))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	runner := newTestRunner(t, server, []string{ipthc.ModeDNS}, &buf)
+
+	err := runner.Run(ctx, strings.NewReader("1.1.1.1\n1.1.1.2\n1.1.1.3\n1.1.1.4\n"), 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("expected the run to stop after 1 request, got %d", requests)
+	}
+	if runner.Failures() != 0 {
+		t.Errorf("interrupted queries should not count as failures, got %d", runner.Failures())
+	}
+}
+
+func TestRunner_TruncatedQueryIsMarked(t *testing.T) {
+	server := ipthctest.NewServer()
+	defer server.Close()
+	server.AddSubdomains("example.com", "a.example.com", "b.example.com", "c.example.com", "d.example.com", "e.example.com")
+	server.AddSubdomains("example.org", "a.example.org")
+	server.SetPageSize(2)
+
+	logFile := filepath.Join(t.TempDir(), "errors.log")
+	logger, err := NewErrorLogger(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	var buf bytes.Buffer
+	out, _ := NewResultWriter(FormatNDJSON, &buf, false)
+	client := ipthc.NewClient(server.URL, 0, 0, false)
+	client.MaxPages = 2
+	runner := &Runner{
+		Client:   client,
+		Out:      out,
+		Logger:   logger,
+		Modes:    []string{ipthc.ModeSubs},
+		MaxRange: defaultMaxRange,
+	}
+
+	if err := runner.Run(context.Background(), strings.NewReader("example.com\nexample.org\n"), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if runner.Truncated() != 1 || runner.Failures() != 0 {
+		t.Errorf("expected 1 truncated query and no failures, got %d and %d", runner.Truncated(), runner.Failures())
+	}
+
+	var results, markers []Result
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var r Result
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", line, err)
+		}
+		if r.IsMarker() {
+			markers = append(markers, r)
+		} else {
+			results = append(results, r)
+		}
+	}
+	if len(results) != 5 {
+		t.Errorf("expected 4 results before the cap plus 1 from example.org, got %d", len(results))
+	}
+	if len(markers) != 1 || markers[0].Input != "example.com" || *markers[0].Truncated != (Truncation{Pages: 2, Fetched: 4, Total: 5}) {
+		t.Errorf("unexpected truncation markers: %+v", markers)
+	}
+
+	logger.Close()
+	data, _ := os.ReadFile(logFile)
+	if !strings.Contains(string(data), "fetched 4 of 5 results") {
+		t.Errorf("error log should record the truncation: %s", data)
+	}
+}
+
+func TestRunner_PaginationInconsistencies(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sb/short.example.com":
+			// Advertises 3 results but only ever sends 2
+			w.Write([]byte(";;Entries: 2/3\na.short.example.com\nb.short.example.com"))
+		case "/sb/loop.example.com":
+			w.Write([]byte(";;Entries: 1/9\n;;Next Page: " + server.URL + "/sb/loop.example.com\na.loop.example.com"))
+		}
+	}))
+	defer server.Close()
+
+	logFile := filepath.Join(t.TempDir(), "errors.log")
+	logger, err := NewErrorLogger(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	state, err := OpenStateJournal(filepath.Join(t.TempDir(), "run.state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	var buf bytes.Buffer
+	out, _ := NewResultWriter(FormatText, &buf, false)
+	runner := &Runner{
+		Client:   ipthc.NewClient(server.URL, 0, 0, false),
+		Out:      out,
+		Logger:   logger,
+		State:    state,
+		Modes:    []string{ipthc.ModeSubs},
+		MaxRange: defaultMaxRange,
+	}
+	runner.Client.Warn = runner.Warn
+
+	if err := runner.Run(context.Background(), strings.NewReader("short.example.com\nloop.example.com\n"), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The short count is a warning and the query counts as done; the loop is a failure
+	if runner.Mismatched() != 1 || runner.Failures() != 1 {
+		t.Errorf("expected 1 mismatch and 1 failure, got %d and %d", runner.Mismatched(), runner.Failures())
+	}
+	if !state.Done(ipthc.ModeSubs, "short.example.com") || state.Done(ipthc.ModeSubs, "loop.example.com") {
+		t.Error("only the mismatched query should be marked done")
+	}
+	if got := sortedLines(buf.String()); !reflect.DeepEqual(got, []string{"a.loop.example.com", "a.short.example.com", "b.short.example.com"}) {
+		t.Errorf("results before an inconsistency should still be written, got %v", got)
+	}
+
+	logger.Close()
+	data, _ := os.ReadFile(logFile)
+	for _, want := range []string{"warning: fetched 2 results but the API advertised 3", "next page link repeats page 1"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("error log should contain %q:\n%s", want, data)
+		}
+	}
+}
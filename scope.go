@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+// ScopeList is a set of rules loaded from a scope file, one per line:
+//
+//	example.com        exact domain
+//	*.example.com      any subdomain of example.com (not example.com itself)
+//	/^dev-\d+\./       regular expression between slashes
+//	10.0.0.0/8         CIDR block, dash range or single IP, matching IP results
+//
+// Blank lines and lines starting with # are ignored.
+type ScopeList struct {
+	exact    map[string]bool
+	suffixes []string // ".example.com" for *.example.com
+	patterns []*regexp.Regexp
+	ranges   []IPRange
+}
+
+// LoadScopeList reads a scope file
+func LoadScopeList(path string) (*ScopeList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scope file: %w", err)
+	}
+	defer file.Close()
+
+	s := &ScopeList{exact: make(map[string]bool)}
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := ipthc.SanitizeInput(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if err := s.Add(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read scope file: %w", err)
+	}
+	return s, nil
+}
+
+// Add parses a single rule and adds it to the list
+func (s *ScopeList) Add(rule string) error {
+	if s.exact == nil {
+		s.exact = make(map[string]bool)
+	}
+
+	switch {
+	case len(rule) > 1 && rule[0] == '/' && rule[len(rule)-1] == '/':
+		re, err := regexp.Compile(rule[1 : len(rule)-1])
+		if err != nil {
+			return fmt.Errorf("invalid scope pattern %s: %w", rule, err)
+		}
+		s.patterns = append(s.patterns, re)
+
+	case ipthc.ValidateIP(rule) == nil:
+		addr, _ := netip.ParseAddr(rule)
+		s.ranges = append(s.ranges, IPRange{First: addr.Unmap(), Last: addr.Unmap()})
+
+	case isRangeRule(rule):
+		r, err := ParseIPRange(rule)
+		if err != nil {
+			return err
+		}
+		s.ranges = append(s.ranges, r)
+
+	case strings.HasPrefix(rule, "*."):
+		domain := normalizeHost(rule[2:])
+		if err := ipthc.ValidateDomain(domain); err != nil {
+			return fmt.Errorf("invalid scope wildcard %s: %w", rule, err)
+		}
+		s.suffixes = append(s.suffixes, "."+domain)
+
+	default:
+		domain := normalizeHost(rule)
+		if err := ipthc.ValidateDomain(domain); err != nil {
+			return fmt.Errorf("invalid scope entry %s: %w", rule, err)
+		}
+		s.exact[domain] = true
+	}
+	return nil
+}
+
+// isRangeRule reports whether a rule is a CIDR block or an IP dash range
+// rather than a hyphenated domain
+func isRangeRule(rule string) bool {
+	if strings.Contains(rule, "/") {
+		return true
+	}
+	start, _, ok := strings.Cut(rule, "-")
+	return ok && ipthc.ValidateIP(strings.TrimSpace(start)) == nil
+}
+
+// normalizeHost lowercases a hostname and strips a trailing dot
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// Match reports whether value (a hostname or IP address) matches any rule
+func (s *ScopeList) Match(value string) bool {
+	if addr, err := netip.ParseAddr(value); err == nil {
+		for _, r := range s.ranges {
+			if r.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	host := normalizeHost(value)
+	if s.exact[host] {
+		return true
+	}
+	for _, suffix := range s.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	for _, re := range s.patterns {
+		if re.MatchString(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scope decides which results are kept
+// A result is in scope if it matches Include (or Include is nil) and does not
+// match Exclude
+type Scope struct {
+	Include *ScopeList
+	Exclude *ScopeList
+}
+
+// InScope reports whether a result value is in scope
+func (s *Scope) InScope(value string) bool {
+	if s == nil {
+		return true
+	}
+	if s.Include != nil && !s.Include.Match(value) {
+		return false
+	}
+	return s.Exclude == nil || !s.Exclude.Match(value)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeScopeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scope.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestScopeList_Match(t *testing.T) {
+	list, err := LoadScopeList(writeScopeFile(t, `# in scope
+example.com
+my-site.example.net
+*.example.org
+/^dev-[0-9]+\.test\.net$/
+10.0.0.0/8
+192.168.1.1-192.168.1.10
+2001:db8::1
+`))
+	if err != nil {
+		t.Fatalf("LoadScopeList failed: %v", err)
+	}
+
+	tests := []struct {
+		value    string
+		expected bool
+	}{
+		{"example.com", true},
+		{"EXAMPLE.com.", true},
+		{"www.example.com", false},
+		{"my-site.example.net", true},
+		{"www.example.org", true},
+		{"a.b.example.org", true},
+		{"example.org", false},
+		{"badexample.org", false},
+		{"dev-42.test.net", true},
+		{"dev-x.test.net", false},
+		{"10.20.30.40", true},
+		{"11.0.0.1", false},
+		{"192.168.1.5", true},
+		{"192.168.1.11", false},
+		{"2001:db8::1", true},
+		{"2001:db8::2", false},
+	}
+
+	for _, tt := range tests {
+		if got := list.Match(tt.value); got != tt.expected {
+			t.Errorf("Match(%q) = %v, want %v", tt.value, got, tt.expected)
+		}
+	}
+}
+
+func TestLoadScopeList_Invalid(t *testing.T) {
+	for _, content := range []string{
+		"/[unclosed/\n",
+		"10.0.0.0/33\n",
+		"*.nodot\n",
+		"not a domain\n",
+	} {
+		if _, err := LoadScopeList(writeScopeFile(t, content)); err == nil {
+			t.Errorf("expected error for %q", content)
+		}
+	}
+}
+
+func TestScope_InScope(t *testing.T) {
+	include := &ScopeList{}
+	include.Add("*.example.com")
+	exclude := &ScopeList{}
+	exclude.Add("mail.example.com")
+
+	tests := []struct {
+		scope    *Scope
+		value    string
+		expected bool
+	}{
+		{nil, "anything.net", true},
+		{&Scope{Include: include}, "www.example.com", true},
+		{&Scope{Include: include}, "www.other.net", false},
+		{&Scope{Include: include, Exclude: exclude}, "mail.example.com", false},
+		{&Scope{Exclude: exclude}, "www.other.net", true},
+		{&Scope{Exclude: exclude}, "mail.example.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.scope.InScope(tt.value); got != tt.expected {
+			t.Errorf("InScope(%q) = %v, want %v", tt.value, got, tt.expected)
+		}
+	}
+}
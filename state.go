@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+// StateJournal records which queries finished, how far paginated queries got
+// and which jobs were derived while recursing, so an interrupted run can be
+// resumed with the same state file.
+// The file is an append-only log of JSON lines; the last entry for a query wins.
+type StateJournal struct {
+	mu      sync.Mutex
+	file    *os.File
+	entries map[string]stateEntry
+	queued  map[string]bool // mode+input of every derived job journaled
+	derived []Job           // Derived jobs in the order they were queued
+}
+
+// stateEntry is one line of the journal
+type stateEntry struct {
+	Mode  string `json:"mode"`
+	Input string `json:"input"`
+	Done  bool   `json:"done,omitempty"`
+	ipthc.Checkpoint
+
+	// Set on entries journaling a derived job rather than query progress
+	Queued bool   `json:"queued,omitempty"`
+	From   string `json:"from,omitempty"`
+	Depth  int    `json:"depth,omitempty"`
+}
+
+// OpenStateJournal loads an existing state file (if any) and opens it for appending
+func OpenStateJournal(filename string) (*StateJournal, error) {
+	s := &StateJournal{entries: make(map[string]stateEntry), queued: make(map[string]bool)}
+
+	size, err := s.load(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
+	}
+
+	// Drop a torn last line so the next entry starts on a line of its own
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to repair state file: %w", err)
+	}
+	s.file = file
+
+	return s, nil
+}
+
+// load replays the journal into memory and returns the length of its
+// complete lines. A final line without a newline (from a crash mid-write)
+// is ignored.
+func (s *StateJournal) load(filename string) (int64, error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read state file: %w", err)
+	}
+	defer file.Close()
+
+	var size int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read state file: %w", err)
+		}
+		size += int64(len(line))
+
+		var entry stateEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		s.apply(entry)
+	}
+}
+
+// apply adds a journal entry to the in-memory state
+// Derived jobs are kept apart so they never replace a query's progress
+func (s *StateJournal) apply(entry stateEntry) {
+	key := stateKey(entry.Mode, entry.Input)
+	if !entry.Queued {
+		s.entries[key] = entry
+		return
+	}
+	if !s.queued[key] {
+		s.queued[key] = true
+		s.derived = append(s.derived, Job{Input: entry.Input, Mode: entry.Mode, Depth: entry.Depth, From: entry.From})
+	}
+}
+
+func stateKey(mode, input string) string {
+	return mode + " " + input
+}
+
+// Done reports whether a query completed in a previous run
+func (s *StateJournal) Done(mode, input string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[stateKey(mode, input)].Done
+}
+
+// Checkpoint returns where an unfinished query should resume, or nil to start over
+func (s *StateJournal) Checkpoint(mode, input string) *ipthc.Checkpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[stateKey(mode, input)]
+	if !ok || entry.Done || entry.NextPageURL == "" {
+		return nil
+	}
+	cp := entry.Checkpoint
+	return &cp
+}
+
+// Record journals the progress of a query after a page was handled
+func (s *StateJournal) Record(mode, input string, cp ipthc.Checkpoint) error {
+	return s.write(stateEntry{Mode: mode, Input: input, Checkpoint: cp})
+}
+
+// Queue journals a job derived from another query's results, so a resumed run
+// still runs it when the query it came from is already done
+func (s *StateJournal) Queue(job Job) error {
+	s.mu.Lock()
+	known := s.queued[stateKey(job.Mode, job.Input)]
+	s.mu.Unlock()
+	if known {
+		return nil
+	}
+	return s.write(stateEntry{Mode: job.Mode, Input: job.Input, Queued: true, From: job.From, Depth: job.Depth})
+}
+
+// Derived returns the jobs queued by earlier runs that have not completed
+func (s *StateJournal) Derived() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []Job
+	for _, job := range s.derived {
+		if !s.entries[stateKey(job.Mode, job.Input)].Done {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// MarkDone journals that a query completed successfully
+func (s *StateJournal) MarkDone(mode, input string) error {
+	return s.write(stateEntry{Mode: mode, Input: input, Done: true})
+}
+
+// write appends an entry and syncs it to disk so it survives a crash
+func (s *StateJournal) write(entry stateEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync state: %w", err)
+	}
+
+	s.apply(entry)
+	return nil
+}
+
+// Close closes the state file
+func (s *StateJournal) Close() error {
+	if s.file != nil {
+		return s.file.Close()
+	}
+	return nil
+}
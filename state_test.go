@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+// pagedServer serves /sb/example.com as `pages` pages of two results each
+func pagedServer(t *testing.T, pages int, hits map[string]int) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := 1
+		fmt.Sscanf(r.URL.Query().Get("page"), "%d", &page)
+		hits[fmt.Sprint(page)]++
+
+		fmt.Fprintf(w, ";;Entries: 2/%d\n", pages*2)
+		if page < pages {
+			fmt.Fprintf(w, ";;Next Page: %s/sb/example.com?page=%d\n", server.URL, page+1)
+		}
+		fmt.Fprintf(w, "sub%d-a.example.com\nsub%d-b.example.com\n", page, page)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestStateJournal_ResumeAfterCrashBetweenPages(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.jsonl")
+	hits := make(map[string]int)
+	server := pagedServer(t, 4, hits)
+	client := ipthc.NewClient(server.URL, 0, 0, false)
+
+	// First run: the process "dies" right after page 2 has been handled
+	state, err := OpenStateJournal(stateFile)
+	if err != nil {
+		t.Fatalf("OpenStateJournal failed: %v", err)
+	}
+
+	errCrash := errors.New("killed")
+	var firstRun []string
+	checkpoint := func(cp ipthc.Checkpoint) error {
+		if err := state.Record(ipthc.ModeSubs, "example.com", cp); err != nil {
+			return err
+		}
+		if cp.Page == 2 {
+			return errCrash
+		}
+		return nil
+	}
+	err = client.QueryFrom(context.Background(), ipthc.ModeSubs, "example.com", nil, func(results []string, _, _ int) error {
+		firstRun = append(firstRun, results...)
+		return nil
+	}, checkpoint)
+	if !errors.Is(err, errCrash) {
+		t.Fatalf("expected simulated crash, got %v", err)
+	}
+	state.Close()
+
+	// Second run: reload from disk and resume
+	state, err = OpenStateJournal(stateFile)
+	if err != nil {
+		t.Fatalf("reopening state failed: %v", err)
+	}
+	defer state.Close()
+
+	if state.Done(ipthc.ModeSubs, "example.com") {
+		t.Fatal("interrupted query should not be marked done")
+	}
+	from := state.Checkpoint(ipthc.ModeSubs, "example.com")
+	if from == nil || from.Page != 2 || from.Total != 8 {
+		t.Fatalf("unexpected checkpoint: %+v", from)
+	}
+
+	var secondRun []string
+	var pages []int
+	callback := func(results []string, page int, total int) error {
+		pages = append(pages, page)
+		secondRun = append(secondRun, results...)
+		return nil
+	}
+	record := func(cp ipthc.Checkpoint) error { return state.Record(ipthc.ModeSubs, "example.com", cp) }
+	if err := client.QueryFrom(context.Background(), ipthc.ModeSubs, "example.com", from, callback, record); err != nil {
+		t.Fatalf("resumed query failed: %v", err)
+	}
+	state.MarkDone(ipthc.ModeSubs, "example.com")
+
+	if len(firstRun) != 4 || len(secondRun) != 4 {
+		t.Errorf("expected 4 results per run, got %v and %v", firstRun, secondRun)
+	}
+	if secondRun[0] != "sub3-a.example.com" {
+		t.Errorf("resume should start at page 3, got %v", secondRun)
+	}
+	if len(pages) != 2 || pages[0] != 3 || pages[1] != 4 {
+		t.Errorf("resumed page numbers = %v, want [3 4]", pages)
+	}
+	for page, n := range hits {
+		if n != 1 {
+			t.Errorf("page %s fetched %d times, want 1", page, n)
+		}
+	}
+
+	// Third run: everything is done
+	state.Close()
+	state, _ = OpenStateJournal(stateFile)
+	if !state.Done(ipthc.ModeSubs, "example.com") {
+		t.Error("query should be marked done after completion")
+	}
+	if state.Checkpoint(ipthc.ModeSubs, "example.com") != nil {
+		t.Error("finished query should have no checkpoint")
+	}
+}
+
+func TestStateJournal_IgnoresTornLastLine(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.jsonl")
+	content := `{"mode":"dns","input":"1.1.1.1","done":true}
+{"mode":"subs","input":"example.com","page":3,"total":30,"next":"https://ip.thc.org/sb/example.com?p=4"}
+{"mode":"subs","input":"example.com","pa`
+	if err := os.WriteFile(stateFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := OpenStateJournal(stateFile)
+	if err != nil {
+		t.Fatalf("OpenStateJournal failed: %v", err)
+	}
+
+	if !state.Done(ipthc.ModeDNS, "1.1.1.1") {
+		t.Error("1.1.1.1 should be done")
+	}
+	cp := state.Checkpoint(ipthc.ModeSubs, "example.com")
+	if cp == nil || cp.Page != 3 || cp.NextPageURL != "https://ip.thc.org/sb/example.com?p=4" {
+		t.Errorf("unexpected checkpoint: %+v", cp)
+	}
+
+	// The next entry must not be glued onto the torn fragment
+	if err := state.MarkDone(ipthc.ModeSubs, "example.com"); err != nil {
+		t.Fatalf("MarkDone failed: %v", err)
+	}
+	state.Close()
+
+	state, err = OpenStateJournal(stateFile)
+	if err != nil {
+		t.Fatalf("reopening state failed: %v", err)
+	}
+	defer state.Close()
+	if !state.Done(ipthc.ModeSubs, "example.com") {
+		t.Error("entry appended after a torn line was lost")
+	}
+}
+
+func TestStateJournal_ModesAreSeparate(t *testing.T) {
+	state, err := OpenStateJournal(filepath.Join(t.TempDir(), "state.jsonl"))
+	if err != nil {
+		t.Fatalf("OpenStateJournal failed: %v", err)
+	}
+	defer state.Close()
+
+	state.MarkDone(ipthc.ModeSubs, "example.com")
+
+	if state.Done(ipthc.ModeCNAME, "example.com") {
+		t.Error("completing subs should not mark cname as done")
+	}
+}
+
+func TestStateJournal_ResumeRunsDerivedJobs(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.jsonl")
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	apexDown := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hits[r.URL.Path]++
+
+		switch r.URL.Path {
+		case "/1.1.1.1":
+			w.Write([]byte(";;Entries: 1/1\nwww.example.com"))
+		case "/sb/example.com":
+			if apexDown {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(";;Entries: 1/1\napi.example.com"))
+		default:
+			w.Write([]byte(";;Entries: 0/0"))
+		}
+	}))
+	defer server.Close()
+
+	run := func() string {
+		t.Helper()
+		state, err := OpenStateJournal(stateFile)
+		if err != nil {
+			t.Fatalf("OpenStateJournal failed: %v", err)
+		}
+		defer state.Close()
+
+		var buf bytes.Buffer
+		runner := newTestRunner(t, server, []string{ipthc.ModeDNS}, &buf)
+		runner.Out, _ = NewResultWriter(FormatText, &buf, true)
+		runner.Client.Retry = ipthc.RetryPolicy{}
+		runner.State = state
+		runner.MaxDepth = 2
+		if err := runner.Run(context.Background(), strings.NewReader("1.1.1.1\n"), 2); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		return buf.String()
+	}
+
+	// First run: the seed completes but the apex it pivoted to fails
+	run()
+	mu.Lock()
+	apexDown = false
+	mu.Unlock()
+
+	// Second run: the seed is skipped, yet its derived job still runs
+	out := run()
+	if hits["/1.1.1.1"] != 1 {
+		t.Errorf("seed queried %d times, want 1", hits["/1.1.1.1"])
+	}
+	if hits["/sb/example.com"] != 2 {
+		t.Errorf("derived apex queried %d times, want 2", hits["/sb/example.com"])
+	}
+	if out != "subs\tapi.example.com\n" {
+		t.Errorf("resumed output = %q, want the derived job's result", out)
+	}
+}
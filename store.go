@@ -0,0 +1,269 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// storeBatchSize is how many upserts are grouped into one transaction
+const storeBatchSize = 500
+
+const storeSchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	started_at  INTEGER NOT NULL,
+	finished_at INTEGER
+);
+CREATE TABLE IF NOT EXISTS results (
+	mode       TEXT    NOT NULL,
+	input      TEXT    NOT NULL,
+	result     TEXT    NOT NULL,
+	first_seen INTEGER NOT NULL,
+	last_seen  INTEGER NOT NULL,
+	first_run  INTEGER NOT NULL REFERENCES runs(id),
+	last_run   INTEGER NOT NULL REFERENCES runs(id),
+	PRIMARY KEY (mode, input, result)
+);
+CREATE TABLE IF NOT EXISTS run_results (
+	run_id INTEGER NOT NULL REFERENCES runs(id),
+	mode   TEXT    NOT NULL,
+	input  TEXT    NOT NULL,
+	result TEXT    NOT NULL,
+	PRIMARY KEY (run_id, mode, input, result)
+);
+CREATE INDEX IF NOT EXISTS results_input ON results(input);
+CREATE INDEX IF NOT EXISTS results_first_seen ON results(first_seen);
+`
+
+const storeUpsert = `
+INSERT INTO results (mode, input, result, first_seen, last_seen, first_run, last_run)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (mode, input, result) DO UPDATE SET
+	last_seen = excluded.last_seen,
+	last_run  = excluded.last_run
+`
+
+const storeMember = `
+INSERT OR IGNORE INTO run_results (run_id, mode, input, result) VALUES (?, ?, ?, ?)
+`
+
+// ResultStore is a SQLite database of every (mode, input, result) ever seen,
+// with when and in which run it was first and last seen, and which results
+// each run saw. It implements ResultWriter; each run gets its own run ID.
+type ResultStore struct {
+	mu      sync.Mutex
+	db      *sql.DB
+	runID   int64
+	tx      *sql.Tx
+	stmt    *sql.Stmt // Upserts into results
+	member  *sql.Stmt // Records the result as seen by this run
+	pending int
+}
+
+// OpenResultStore opens (creating if needed) the database at path
+func OpenResultStore(path string) (*ResultStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(storeSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	return &ResultStore{db: db}, nil
+}
+
+// StartRun records a new run and returns its ID
+// Results written afterwards are attributed to this run
+func (s *ResultStore) StartRun() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.db.Exec(`INSERT INTO runs (started_at) VALUES (?)`, time.Now().Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to start run: %w", err)
+	}
+	s.runID, err = res.LastInsertId()
+	return s.runID, err
+}
+
+// Write upserts a result, batching writes into transactions
+func (s *ResultStore) Write(r Result) error {
+	if r.IsMarker() {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tx == nil {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		stmt, err := tx.Prepare(storeUpsert)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to prepare upsert: %w", err)
+		}
+		member, err := tx.Prepare(storeMember)
+		if err != nil {
+			stmt.Close()
+			tx.Rollback()
+			return fmt.Errorf("failed to prepare insert: %w", err)
+		}
+		s.tx, s.stmt, s.member = tx, stmt, member
+	}
+
+	ts := r.Timestamp
+	if ts == 0 {
+		ts = time.Now().Unix()
+	}
+	if _, err := s.stmt.Exec(r.Mode, r.Input, r.Result, ts, ts, s.runID, s.runID); err != nil {
+		return fmt.Errorf("failed to store result: %w", err)
+	}
+	if _, err := s.member.Exec(s.runID, r.Mode, r.Input, r.Result); err != nil {
+		return fmt.Errorf("failed to store result: %w", err)
+	}
+
+	s.pending++
+	if s.pending >= storeBatchSize {
+		return s.commit()
+	}
+	return nil
+}
+
+// commit flushes the current batch
+// Caller must hold s.mu
+func (s *ResultStore) commit() error {
+	if s.tx == nil {
+		return nil
+	}
+	s.stmt.Close()
+	s.member.Close()
+	err := s.tx.Commit()
+	s.tx, s.stmt, s.member, s.pending = nil, nil, nil, 0
+	if err != nil {
+		return fmt.Errorf("failed to commit results: %w", err)
+	}
+	return nil
+}
+
+// Finish flushes pending results and marks the run finished, making it the
+// baseline for the next -diff. Runs that were interrupted are left unfinished.
+func (s *ResultStore) Finish() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.commit(); err != nil {
+		return err
+	}
+	if s.runID == 0 {
+		return nil
+	}
+	if _, err := s.db.Exec(`UPDATE runs SET finished_at = ? WHERE id = ?`, time.Now().Unix(), s.runID); err != nil {
+		return fmt.Errorf("failed to finish run: %w", err)
+	}
+	return nil
+}
+
+// Close flushes pending results and closes the database
+func (s *ResultStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.commit()
+	if closeErr := s.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// StoredResult is a result row with its history
+type StoredResult struct {
+	Mode      string    `json:"mode"`
+	Input     string    `json:"input"`
+	Result    string    `json:"result"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	FirstRun  int64     `json:"first_run"`
+	LastRun   int64     `json:"last_run"`
+}
+
+// StoreQuery selects stored results
+type StoreQuery struct {
+	Input string    // Required: the target that was queried
+	Mode  string    // Optional mode filter
+	Since time.Time // Optional: only results first seen at or after this time
+}
+
+// LastRun returns the results seen in the most recent finished run
+func (s *ResultStore) LastRun() ([]StoredResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows, err := s.db.Query(`SELECT r.mode, r.input, r.result, r.first_seen, r.last_seen, r.first_run, r.last_run
+		FROM results r JOIN run_results m USING (mode, input, result)
+		WHERE m.run_id = (SELECT MAX(id) FROM runs WHERE finished_at IS NOT NULL)
+		ORDER BY r.mode, r.input, r.result`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query database: %w", err)
+	}
+	return scanStoredResults(rows)
+}
+
+// Query returns stored results for a target, oldest first
+// Any pending batch is committed first
+func (s *ResultStore) Query(q StoreQuery) ([]StoredResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The open batch holds the only connection, and its rows should be visible
+	if err := s.commit(); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT mode, input, result, first_seen, last_seen, first_run, last_run
+		FROM results WHERE input = ?`
+	args := []any{q.Input}
+	if q.Mode != "" {
+		query += ` AND mode = ?`
+		args = append(args, q.Mode)
+	}
+	if !q.Since.IsZero() {
+		query += ` AND first_seen >= ?`
+		args = append(args, q.Since.Unix())
+	}
+	query += ` ORDER BY first_seen, mode, result`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query database: %w", err)
+	}
+	return scanStoredResults(rows)
+}
+
+// scanStoredResults reads and closes rows of stored results
+func scanStoredResults(rows *sql.Rows) ([]StoredResult, error) {
+	defer rows.Close()
+
+	var results []StoredResult
+	for rows.Next() {
+		var r StoredResult
+		var firstSeen, lastSeen int64
+		if err := rows.Scan(&r.Mode, &r.Input, &r.Result, &firstSeen, &lastSeen, &r.FirstRun, &r.LastRun); err != nil {
+			return nil, fmt.Errorf("failed to read result: %w", err)
+		}
+		r.FirstSeen = time.Unix(firstSeen, 0)
+		r.LastSeen = time.Unix(lastSeen, 0)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+func TestResultStore_FirstAndLastSeen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.sqlite")
+	week := time.Now().Add(-7 * 24 * time.Hour).Unix()
+	now := time.Now().Unix()
+
+	// First run, a week ago
+	store, err := OpenResultStore(path)
+	if err != nil {
+		t.Fatalf("OpenResultStore failed: %v", err)
+	}
+	run1, _ := store.StartRun()
+	store.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "www.example.com", Timestamp: week})
+	store.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "old.example.com", Timestamp: week})
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Second run, today
+	store, _ = OpenResultStore(path)
+	run2, _ := store.StartRun()
+	store.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "www.example.com", Timestamp: now})
+	store.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "new.example.com", Timestamp: now})
+	store.Write(Result{Mode: ipthc.ModeCNAME, Input: "example.com", Result: "alias.example.net", Timestamp: now})
+	store.Close()
+
+	if run1 == run2 {
+		t.Fatalf("runs should get distinct IDs, both got %d", run1)
+	}
+
+	store, _ = OpenResultStore(path)
+	defer store.Close()
+
+	results, err := store.Query(StoreQuery{Input: "example.com", Mode: ipthc.ModeSubs})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3: %+v", len(results), results)
+	}
+
+	byResult := make(map[string]StoredResult)
+	for _, r := range results {
+		byResult[r.Result] = r
+	}
+
+	www := byResult["www.example.com"]
+	if www.FirstSeen.Unix() != week || www.LastSeen.Unix() != now {
+		t.Errorf("www first/last seen = %v/%v", www.FirstSeen, www.LastSeen)
+	}
+	if www.FirstRun != run1 || www.LastRun != run2 {
+		t.Errorf("www runs = %d/%d, want %d/%d", www.FirstRun, www.LastRun, run1, run2)
+	}
+	if old := byResult["old.example.com"]; old.LastRun != run1 {
+		t.Errorf("old.example.com should not have been seen in run %d", old.LastRun)
+	}
+
+	// What's new since yesterday?
+	recent, _ := store.Query(StoreQuery{Input: "example.com", Since: time.Now().Add(-24 * time.Hour)})
+	if len(recent) != 2 {
+		t.Errorf("expected 2 new results, got %+v", recent)
+	}
+}
+
+func TestResultStore_BatchesLargeRuns(t *testing.T) {
+	store, err := OpenResultStore(filepath.Join(t.TempDir(), "results.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenResultStore failed: %v", err)
+	}
+	store.StartRun()
+
+	for i := 0; i < storeBatchSize*2+10; i++ {
+		if err := store.Write(Result{Mode: ipthc.ModeDNS, Input: "1.1.1.1", Result: strings.Repeat("a", i%50+1) + ".example.com"}); err != nil {
+			t.Fatalf("Write %d failed: %v", i, err)
+		}
+	}
+
+	results, err := store.Query(StoreQuery{Input: "1.1.1.1"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	// 50 distinct results, including those still in the open batch
+	if len(results) != 50 {
+		t.Errorf("got %d results, want 50", len(results))
+	}
+	store.Close()
+}
+
+func TestRunDBCommand_Query(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.sqlite")
+	store, _ := OpenResultStore(path)
+	store.StartRun()
+	store.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "www.example.com"})
+	store.Write(Result{Mode: ipthc.ModeSubs, Input: "other.com", Result: "www.other.com"})
+	store.Close()
+
+	var stdout, stderr bytes.Buffer
+	code := runDBCommand([]string{"query", "-db", path, "example.com"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+
+	out := stdout.String()
+	if !strings.Contains(out, "\tsubs\texample.com\twww.example.com") {
+		t.Errorf("unexpected output: %q", out)
+	}
+	if strings.Contains(out, "other.com") {
+		t.Errorf("output should only include the requested target: %q", out)
+	}
+}
+
+func TestRunDBCommand_Usage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	if code := runDBCommand(nil, &stdout, &stderr); code == 0 {
+		t.Error("missing subcommand should fail")
+	}
+	if code := runDBCommand([]string{"query", "example.com"}, &stdout, &stderr); code == 0 {
+		t.Error("missing -db should fail")
+	}
+	if code := runDBCommand([]string{"query", "-db", filepath.Join(t.TempDir(), "missing.sqlite"), "example.com"}, &stdout, &stderr); code == 0 {
+		t.Error("nonexistent database should fail")
+	}
+}
+
+func TestResultStore_LastRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.sqlite")
+
+	store, _ := OpenResultStore(path)
+	if results, err := store.LastRun(); err != nil || len(results) != 0 {
+		t.Errorf("empty store: got %v, %v", results, err)
+	}
+	store.StartRun()
+	store.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "a.example.com"})
+	store.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "old.example.com"})
+	store.Finish()
+	store.Close()
+
+	store, _ = OpenResultStore(path)
+	store.StartRun()
+	store.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "a.example.com"})
+	store.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "b.example.com"})
+	store.Finish()
+	store.Close()
+
+	// An interrupted run re-sees one result and finds a new one, but is not a
+	// usable baseline and must not hide what the finished run saw. It also
+	// re-sees a result the finished run did not, which must not count either.
+	store, _ = OpenResultStore(path)
+	store.StartRun()
+	store.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "b.example.com"})
+	store.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "c.example.com"})
+	store.Write(Result{Mode: ipthc.ModeSubs, Input: "example.com", Result: "old.example.com"})
+	store.Close()
+
+	store, _ = OpenResultStore(path)
+	defer store.Close()
+
+	results, err := store.LastRun()
+	if err != nil {
+		t.Fatalf("LastRun failed: %v", err)
+	}
+	var got []string
+	for _, r := range results {
+		got = append(got, r.Result)
+	}
+	if want := []string{"a.example.com", "b.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LastRun() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+// Takeover confidence levels
+const (
+	ConfidenceHigh   = "high"   // Anyone can claim the name once the resource is gone
+	ConfidenceMedium = "medium" // Claimable under conditions such as missing domain verification
+	ConfidenceLow    = "low"    // Rarely claimable, worth a manual look
+)
+
+//go:embed takeover_fingerprints.json
+var builtinFingerprints []byte
+
+// Fingerprint describes a provider whose CNAME targets can be taken over
+// when the resource behind them has been deprovisioned
+type Fingerprint struct {
+	ID         string   `json:"id"`
+	Provider   string   `json:"provider"`
+	Confidence string   `json:"confidence"`
+	Patterns   []string `json:"patterns"` // Scope rules (exact, *.wildcard or /regex/) matching CNAME targets
+	Notes      string   `json:"notes,omitempty"`
+
+	targets *ScopeList
+}
+
+// TakeoverMatch flags a result as a takeover candidate
+type TakeoverMatch struct {
+	Provider   string `json:"provider"`
+	ID         string `json:"id"`
+	Confidence string `json:"confidence"`
+	Target     string `json:"target"` // The CNAME target that matched
+}
+
+// Fingerprints is a takeover fingerprint database
+type Fingerprints []*Fingerprint
+
+// LoadFingerprints reads a fingerprint database from path, or returns the
+// built-in database when path is empty
+func LoadFingerprints(path string) (Fingerprints, error) {
+	data := builtinFingerprints
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read fingerprints: %w", err)
+		}
+	}
+	return ParseFingerprints(data)
+}
+
+// ParseFingerprints parses and validates a JSON fingerprint database
+func ParseFingerprints(data []byte) (Fingerprints, error) {
+	var fps Fingerprints
+	if err := json.Unmarshal(data, &fps); err != nil {
+		return nil, fmt.Errorf("invalid fingerprints: %w", err)
+	}
+
+	for _, fp := range fps {
+		switch fp.Confidence {
+		case ConfidenceHigh, ConfidenceMedium, ConfidenceLow:
+		default:
+			return nil, fmt.Errorf("fingerprint %s: invalid confidence %q", fp.ID, fp.Confidence)
+		}
+		if fp.ID == "" || len(fp.Patterns) == 0 {
+			return nil, fmt.Errorf("fingerprint %q: id and patterns are required", fp.ID)
+		}
+
+		fp.targets = &ScopeList{}
+		for _, pattern := range fp.Patterns {
+			if err := fp.targets.Add(pattern); err != nil {
+				return nil, fmt.Errorf("fingerprint %s: %w", fp.ID, err)
+			}
+		}
+	}
+	return fps, nil
+}
+
+// Match returns the first fingerprint matching a CNAME target, or nil
+func (fps Fingerprints) Match(target string) *TakeoverMatch {
+	for _, fp := range fps {
+		if fp.targets.Match(target) {
+			return &TakeoverMatch{
+				Provider:   fp.Provider,
+				ID:         fp.ID,
+				Confidence: fp.Confidence,
+				Target:     normalizeHost(target),
+			}
+		}
+	}
+	return nil
+}
+
+// TakeoverWriter flags cname results whose target belongs to a provider in
+// the fingerprint database. The domains returned for such a target point at
+// it and are candidates for takeover if the resource behind it is gone.
+type TakeoverWriter struct {
+	out          ResultWriter
+	fingerprints Fingerprints
+	candidates   atomic.Int64
+}
+
+// NewTakeoverWriter creates a result writer that annotates takeover candidates
+func NewTakeoverWriter(out ResultWriter, fingerprints Fingerprints) *TakeoverWriter {
+	return &TakeoverWriter{out: out, fingerprints: fingerprints}
+}
+
+func (t *TakeoverWriter) Write(r Result) error {
+	if r.Mode == ipthc.ModeCNAME && r.Change != ChangeRemoved && !r.IsMarker() {
+		if match := t.fingerprints.Match(r.Input); match != nil {
+			r.Takeover = match
+			t.candidates.Add(1)
+		}
+	}
+	return t.out.Write(r)
+}
+
+func (t *TakeoverWriter) Close() error {
+	return t.out.Close()
+}
+
+// Candidates returns the number of results flagged so far
+func (t *TakeoverWriter) Candidates() int64 {
+	return t.candidates.Load()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DFC302/ipthc/pkg/ipthc"
+)
+
+func TestBuiltinFingerprints(t *testing.T) {
+	fps, err := LoadFingerprints("")
+	if err != nil {
+		t.Fatalf("built-in fingerprints are invalid: %v", err)
+	}
+	if len(fps) < 10 {
+		t.Errorf("expected a populated built-in database, got %d providers", len(fps))
+	}
+
+	seen := make(map[string]bool)
+	for _, fp := range fps {
+		if seen[fp.ID] {
+			t.Errorf("duplicate fingerprint id %s", fp.ID)
+		}
+		seen[fp.ID] = true
+	}
+}
+
+func TestFingerprints_Match(t *testing.T) {
+	fps, _ := LoadFingerprints("")
+
+	tests := []struct {
+		target     string
+		id         string
+		confidence string
+	}{
+		{"assets.s3.amazonaws.com", "aws-s3", ConfidenceHigh},
+		{"assets.s3-website-us-east-1.amazonaws.com", "aws-s3", ConfidenceHigh},
+		{"myapp.azurewebsites.net", "azure", ConfidenceHigh},
+		{"Old-Site.GitHub.io.", "github-pages", ConfidenceMedium},
+		{"shop.herokuapp.com", "heroku", ConfidenceMedium},
+		{"www.example.com", "", ""},
+		{"github.io.example.com", "", ""},
+	}
+
+	for _, tt := range tests {
+		match := fps.Match(tt.target)
+		if tt.id == "" {
+			if match != nil {
+				t.Errorf("Match(%q) = %+v, want no match", tt.target, match)
+			}
+			continue
+		}
+		if match == nil || match.ID != tt.id || match.Confidence != tt.confidence {
+			t.Errorf("Match(%q) = %+v, want %s/%s", tt.target, match, tt.id, tt.confidence)
+		}
+	}
+}
+
+func TestLoadFingerprints_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fingerprints.json")
+	os.WriteFile(path, []byte(`[{"id":"acme","provider":"Acme Hosting","confidence":"high","patterns":["*.acme-sites.test"]}]`), 0644)
+
+	fps, err := LoadFingerprints(path)
+	if err != nil {
+		t.Fatalf("LoadFingerprints failed: %v", err)
+	}
+	if m := fps.Match("blog.acme-sites.test"); m == nil || m.Provider != "Acme Hosting" {
+		t.Errorf("custom fingerprint did not match: %+v", m)
+	}
+	if fps.Match("assets.s3.amazonaws.com") != nil {
+		t.Error("a custom database should replace the built-in one")
+	}
+}
+
+func TestParseFingerprints_Invalid(t *testing.T) {
+	for _, data := range []string{
+		`not json`,
+		`[{"id":"x","provider":"X","confidence":"certain","patterns":["*.x.test"]}]`,
+		`[{"id":"x","provider":"X","confidence":"high","patterns":[]}]`,
+		`[{"id":"x","provider":"X","confidence":"high","patterns":["/[bad/"]}]`,
+	} {
+		if _, err := ParseFingerprints([]byte(data)); err == nil {
+			t.Errorf("expected error for %s", data)
+		}
+	}
+}
+
+func TestTakeoverWriter_Offline(t *testing.T) {
+	// Fixture: domains pointing at a deleted bucket and at an unrelated host
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cn/legacy-assets.s3.amazonaws.com":
+			w.Write([]byte(";;Entries: 2/2\ncdn.example.com\nstatic.example.com"))
+		default:
+			w.Write([]byte(";;Entries: 1/1\nwww.example.com"))
+		}
+	}))
+	defer server.Close()
+
+	fps, _ := LoadFingerprints("")
+
+	var buf bytes.Buffer
+	runner := newTestRunner(t, server, []string{ipthc.ModeCNAME}, &buf)
+	ndjson, _ := NewResultWriter(FormatNDJSON, &buf, false)
+	takeover := NewTakeoverWriter(ndjson, fps)
+	runner.Out = takeover
+
+	runner.Run(context.Background(), strings.NewReader("legacy-assets.s3.amazonaws.com\nlb.example.net\n"), 1)
+	runner.Out.Close()
+
+	flagged := make(map[string]*TakeoverMatch)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var r Result
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+		flagged[r.Result] = r.Takeover
+	}
+
+	for _, domain := range []string{"cdn.example.com", "static.example.com"} {
+		m := flagged[domain]
+		if m == nil || m.ID != "aws-s3" || m.Target != "legacy-assets.s3.amazonaws.com" {
+			t.Errorf("%s: takeover = %+v", domain, m)
+		}
+	}
+	if flagged["www.example.com"] != nil {
+		t.Error("www.example.com should not be flagged")
+	}
+	if takeover.Candidates() != 2 {
+		t.Errorf("Candidates() = %d, want 2", takeover.Candidates())
+	}
+}
+
+func TestTakeoverWriter_Text(t *testing.T) {
+	fps, _ := LoadFingerprints("")
+
+	var buf bytes.Buffer
+	out, _ := NewResultWriter(FormatText, &buf, false)
+	w := NewTakeoverWriter(out, fps)
+
+	w.Write(Result{Mode: ipthc.ModeCNAME, Input: "site.github.io", Result: "docs.example.com"})
+	w.Write(Result{Mode: ipthc.ModeSubs, Input: "github.io", Result: "site.github.io"})
+	w.Close()
+
+	want := "docs.example.com\ttakeover=github-pages\tconfidence=medium\nsite.github.io\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}